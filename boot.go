@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"runtime"
@@ -8,20 +9,17 @@ import (
 	"github.com/codegangsta/cli"
 	"github.com/deis/builder/pkg"
 	"github.com/deis/builder/pkg/cleaner"
-	"github.com/deis/builder/pkg/conf"
+	"github.com/deis/builder/pkg/controller"
 	"github.com/deis/builder/pkg/gitreceive"
 	"github.com/deis/builder/pkg/healthsrv"
 	"github.com/deis/builder/pkg/sshd"
+	"github.com/deis/builder/pkg/storage"
 	"github.com/deis/builder/pkg/sys"
 	pkglog "github.com/deis/pkg/log"
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
-	_ "github.com/docker/distribution/registry/storage/driver/azure"
-	"github.com/docker/distribution/registry/storage/driver/factory"
-	_ "github.com/docker/distribution/registry/storage/driver/gcs"
-	_ "github.com/docker/distribution/registry/storage/driver/s3-aws"
-	_ "github.com/docker/distribution/registry/storage/driver/swift"
 	"github.com/kelseyhightower/envconfig"
 	kcl "k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/labels"
 )
 
 const (
@@ -58,17 +56,7 @@ func main() {
 				pushLock := sshd.NewInMemoryRepositoryLock(cnf.GitLockTimeout())
 				circ := sshd.NewCircuit()
 
-				storageParams, err := conf.GetStorageParams(env)
-				if err != nil {
-					log.Printf("Error getting storage parameters (%s)", err)
-					os.Exit(1)
-				}
-				var storageDriver storagedriver.StorageDriver
-				if cnf.StorageType == "minio" {
-					storageDriver, err = factory.Create("s3", storageParams)
-				} else {
-					storageDriver, err = factory.Create(cnf.StorageType, storageParams)
-				}
+				storageDriver, err := newStorageDriver(serverConfAppName, env, storage.DefaultBackoff())
 				if err != nil {
 					log.Printf("Error creating storage driver (%s)", err)
 					os.Exit(1)
@@ -79,17 +67,66 @@ func main() {
 					log.Printf("Error getting kubernetes client [%s]", err)
 					os.Exit(1)
 				}
+				cleanerReports := cleaner.NewReports()
 				log.Printf("Starting health check server on port %d", cnf.HealthSrvPort)
 				healthSrvCh := make(chan error)
 				go func() {
-					if err := healthsrv.Start(cnf, kubeClient.Namespaces(), storageDriver, circ); err != nil {
+					if err := healthsrv.Start(cnf, kubeClient.Namespaces(), storageDriver, circ, cleanerReports); err != nil {
 						healthSrvCh <- err
 					}
 				}()
-				log.Printf("Starting deleted app cleaner")
+				retention := cleaner.RetentionPolicy{
+					KeepBuilds:  cnf.SlugRetentionBuilds,
+					MaxAge:      cnf.SlugRetentionMaxAge(),
+					CacheMaxAge: cnf.BuildpackCacheMaxAge(),
+					Interval:    cnf.SlugRetentionInterval(),
+				}
+				if retention.Enabled() && cnf.CleanerControllerToken == "" {
+					log.Printf("Not enforcing the slug retention policy, since CLEANER_CONTROLLER_TOKEN isn't set")
+					retention.KeepBuilds, retention.MaxAge = 0, 0
+				}
+				admin, err := controller.NewAdmin(cnf.ControllerHost, cnf.ControllerPort, cnf.CleanerControllerToken)
+				if err != nil {
+					log.Printf("Error creating controller client (%s)", err)
+					os.Exit(1)
+				}
+				switch cnf.CleanerAppSource {
+				case cleaner.AppSourceNamespaces:
+				case cleaner.AppSourceController:
+					if cnf.CleanerControllerToken == "" {
+						log.Printf("CLEANER_CONTROLLER_TOKEN is required to take the apps from the controller")
+						os.Exit(1)
+					}
+				default:
+					log.Printf("Unknown CLEANER_APP_SOURCE %q", cnf.CleanerAppSource)
+					os.Exit(1)
+				}
+				nsSelector, err := labels.Parse(cnf.CleanerNamespaceSelector)
+				if err != nil {
+					log.Printf("Error parsing CLEANER_NAMESPACE_SELECTOR (%s)", err)
+					os.Exit(1)
+				}
+
+				if cnf.CleanerPollSleepDurationSec > 0 {
+					log.Printf("CLEANER_POLL_SLEEP_DURATION_SEC is deprecated, set CLEANER_RESYNC_PERIOD_SEC instead; resyncing the cleaner every %s", cnf.CleanerResyncPeriod())
+				}
+
+				cleanerOpts := cleaner.Options{
+					AppSource:         cnf.CleanerAppSource,
+					NamespaceSelector: nsSelector,
+					DryRun:            cnf.CleanerDryRun,
+					MaxDeletePercent:  cnf.CleanerMaxDeletePercent,
+					GracePeriod:       cnf.CleanerGracePeriod(),
+					Retention:         retention,
+				}
+				if cleanerOpts.DryRun {
+					log.Printf("Starting deleted app cleaner in dry run mode")
+				} else {
+					log.Printf("Starting deleted app cleaner")
+				}
 				cleanerErrCh := make(chan error)
 				go func() {
-					if err := cleaner.Run(gitHomeDir, kubeClient.Namespaces(), fs, cnf.CleanerPollSleepDuration(), storageDriver); err != nil {
+					if err := cleaner.Run(gitHomeDir, kubeClient.Namespaces(), fs, cnf.CleanerResyncPeriod(), storageDriver, admin, cleanerOpts, cleanerReports); err != nil {
 						cleanerErrCh <- err
 					}
 				}()
@@ -126,17 +163,7 @@ func main() {
 				cnf.CheckDurations()
 				fs := sys.RealFS()
 				env := sys.RealEnv()
-				storageParams, err := conf.GetStorageParams(env)
-				if err != nil {
-					log.Printf("Error getting storage parameters (%s)", err)
-					os.Exit(1)
-				}
-				var storageDriver storagedriver.StorageDriver
-				if cnf.StorageType == "minio" {
-					storageDriver, err = factory.Create("s3", storageParams)
-				} else {
-					storageDriver, err = factory.Create(cnf.StorageType, storageParams)
-				}
+				storageDriver, err := newStorageDriver(gitReceiveConfAppName, env, cnf.ObjectStorageBackoff())
 				if err != nil {
 					log.Printf("Error creating storage driver (%s)", err)
 					os.Exit(1)
@@ -152,3 +179,14 @@ func main() {
 
 	app.Run(os.Args)
 }
+
+// newStorageDriver creates the storage driver from the storage configuration in the environment,
+// retrying failed operations according to backoff.
+func newStorageDriver(appName string, env sys.Env, backoff storage.Backoff) (storagedriver.StorageDriver, error) {
+	cnf := new(storage.Config)
+	if err := envconfig.Process(appName, cnf); err != nil {
+		return nil, fmt.Errorf("getting storage config for %s (%s)", appName, err)
+	}
+	cnf.Backoff = backoff
+	return storage.NewDriver(cnf, env)
+}
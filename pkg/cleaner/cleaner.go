@@ -1,12 +1,12 @@
-// Package cleaner is a background process that compares the kubernetes namespace list with the
-// folders in the local git home directory, deleting what's not in the namespace list.
+// Package cleaner is a background process that compares the apps that exist, according to the
+// kubernetes namespace list or the controller, with the folders in the local git home directory,
+// deleting what's not in the app list.
 package cleaner
 
 import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"time"
 
@@ -16,8 +16,6 @@ import (
 	"github.com/deis/pkg/log"
 	"github.com/docker/distribution/context"
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
-	"k8s.io/kubernetes/pkg/api"
-	"k8s.io/kubernetes/pkg/fields"
 	"k8s.io/kubernetes/pkg/labels"
 )
 
@@ -45,21 +43,21 @@ func localDirs(gitHome string, filter func(string) bool) ([]string, error) {
 	return ret, nil
 }
 
-// getDiff gets the directories that are not in namespaceList
-func getDiff(namespaceList []api.Namespace, dirs []string) []string {
+// getDiff gets the directories that are not in apps
+func getDiff(apps []string, dirs []string) []string {
 	var ret []string
 
-	// create a set of lowercase namespace names
-	namespacesSet := make(map[string]struct{})
-	for _, ns := range namespaceList {
-		lowerName := strings.ToLower(ns.Name)
-		namespacesSet[lowerName] = struct{}{}
+	// create a set of lowercase app names
+	appsSet := make(map[string]struct{})
+	for _, app := range apps {
+		lowerName := strings.ToLower(app)
+		appsSet[lowerName] = struct{}{}
 	}
 
-	// get dirs not in the namespaces set
+	// get dirs not in the apps set
 	for _, dir := range dirs {
 		lowerName := strings.ToLower(dir)
-		if _, ok := namespacesSet[lowerName]; !ok {
+		if _, ok := appsSet[lowerName]; !ok {
 			ret = append(ret, lowerName)
 		}
 	}
@@ -84,7 +82,9 @@ func dirHasGitSuffix(dir string) bool {
 	return strings.HasSuffix(dir, dotGitSuffix)
 }
 
-func deleteFromObjectStore(app string, storageDriver storagedriver.StorageDriver) error {
+// deleteFromObjectStore deletes the cache of app and its build prefixes, which are all of its
+// prefixes in idx.
+func deleteFromObjectStore(app string, storageDriver storagedriver.StorageDriver, idx objectIndex) error {
 
 	cacheKey := fmt.Sprintf(gitreceive.CacheKeyPattern, app)
 
@@ -96,59 +96,300 @@ func deleteFromObjectStore(app string, storageDriver storagedriver.StorageDriver
 		}
 	}
 
-	// delete all slug files matching app
-	objs, err := storageDriver.List(context.Background(), "home")
+	return firstError(deletePrefixes(storageDriver, app, "builds", idx[app]), "builds")
+}
+
+// The sources of the list of apps that exist, which can be set in Options.AppSource.
+const (
+	// AppSourceNamespaces takes the apps from the namespaces matching Options.NamespaceSelector.
+	AppSourceNamespaces = "namespaces"
+	// AppSourceController takes the apps from the controller's app list.
+	AppSourceController = "controller"
+)
+
+// AppLister lists the IDs of the apps that exist.
+type AppLister interface {
+	AppIDs() ([]string, error)
+}
+
+// Controller is the part of the controller API the cleaner uses.
+type Controller interface {
+	AppLister
+	ReleaseGetter
+}
+
+// Options controls what the cleaner deletes, and whether it really does.
+type Options struct {
+	// AppSource is where the cleaner finds out which apps exist.
+	AppSource string
+	// NamespaceSelector selects the namespaces of apps. Namespaces are watched to run the cleaner
+	// as soon as one is deleted, whatever AppSource is. A run in which no namespace matches it
+	// deletes no apps.
+	NamespaceSelector labels.Selector
+	// DryRun makes the cleaner only log and report what it would delete.
+	DryRun bool
+	// MaxDeletePercent is the largest share of the apps, in percent, that a single run may delete.
+	// A run that would delete more than one app and more than this share deletes no apps at all,
+	// since the app list it got is more likely to be wrong than all of those apps to be
+	// gone. 0 turns the check off.
+	MaxDeletePercent int
+	// GracePeriod is the time an app has to be missing for before its data is deleted.
+	GracePeriod time.Duration
+	// Retention is the policy the builds of the remaining apps are held to.
+	Retention RetentionPolicy
+}
+
+// exceedsThreshold returns true if deleting numDelete of numApps apps is more than opts allow.
+func (opts Options) exceedsThreshold(numDelete, numApps int) bool {
+	if opts.MaxDeletePercent <= 0 || numDelete <= 1 {
+		return false
+	}
+	return numDelete*100 > opts.MaxDeletePercent*numApps
+}
+
+// Run starts the deleted app cleaner. It keeps a cache of the namespaces in the cluster matching opts.NamespaceSelector, watched with
+// nsListWatcher and resynced every resync, and compares the apps that exist according to opts.AppSource with the directories in the top
+// level of gitHome on the local file system whenever a namespace is deleted or stops matching, every resync period, and when the grace period of a missing app ends.
+// The builds and buildpack caches of the remaining apps are held to opts.Retention every opts.Retention.Interval, keeping the slugs of their current releases according to ctl,
+// and the stats of their caches are stored in reports.
+// The report of every run is stored in reports.
+// On any error, it uses log messages to output a human readable description of what happened, and tries again with exponential backoff.
+func Run(gitHome string, nsListWatcher k8s.NamespaceListWatcher, fs sys.FS, resync time.Duration, storageDriver storagedriver.StorageDriver, ctl Controller, opts Options, reports *Reports) error {
+	nw := k8s.NewNamespaceWatcher(nsListWatcher, opts.NamespaceSelector, resync)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go nw.Controller.Run(stopCh)
+
+	grace := newGraceTracker(opts.GracePeriod)
+	var lastRetention time.Time
+	var errWait time.Duration
+	for {
+		next := resync
+		if !nw.Controller.HasSynced() {
+			// running with a partial list of namespaces would delete the apps it's missing.
+			next = minErrorWait
+		} else if apps, gitDirs, err := listApps(gitHome, nw, ctl, opts.AppSource); err != nil {
+			errWait = nextErrorWait(errWait, resync)
+			log.Err("Cleaner error listing apps, retrying in %s (%s)", errWait, err)
+			next = errWait
+		} else {
+			errWait = 0
+			now := time.Now()
+			retain := now.Sub(lastRetention) >= opts.Retention.Interval
+			if retain {
+				lastRetention = now
+			}
+			rep := clean(gitHome, apps, gitDirs, grace, fs, storageDriver, ctl, opts, retain, now)
+			reports.set(rep)
+			if retain {
+				reports.setCaches(rep.Caches)
+			}
+			if left, ok := grace.remaining(time.Now()); ok && left < next {
+				next = left
+			}
+		}
+
+		timer := time.NewTimer(next)
+		select {
+		case <-nw.Changed():
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// listApps returns the apps that exist according to source, and those with a local repository in
+// gitHome.
+func listApps(gitHome string, nw *k8s.NamespaceWatcher, appLister AppLister, source string) ([]string, []string, error) {
+	var apps []string
+	switch source {
+	case AppSourceNamespaces:
+		for _, ns := range nw.Namespaces() {
+			apps = append(apps, ns.Name)
+		}
+	case AppSourceController:
+		ids, err := appLister.AppIDs()
+		if err != nil {
+			return nil, nil, err
+		}
+		apps = ids
+	default:
+		return nil, nil, fmt.Errorf("unknown app source %q", source)
+	}
+
+	gitDirs, err := localDirs(gitHome, dirHasGitSuffix)
 	if err != nil {
-		return err
+		return nil, nil, fmt.Errorf("listing local git directories (%s)", err)
 	}
+	return apps, stripSuffixes(gitDirs, dotGitSuffix), nil
+}
 
-	// regex needs prepended / to match output of List()
-	gitRegex, err := regexp.Compile(`^/` + fmt.Sprintf(gitreceive.GitKeyPattern, app, ".{8}") + "$")
+// retainBuilds holds the build prefixes of app to opts.Retention, adding its decisions to rep.
+func retainBuilds(rep *Report, app string, storageDriver storagedriver.StorageDriver, releases ReleaseGetter, opts Options, now time.Time, prefixes []string) {
+	decisions, err := retentionDecisions(app, storageDriver, releases, opts.Retention, now, prefixes)
 	if err != nil {
-		return err
+		log.Err("Cleaner error enforcing the retention policy for app %s (%s)", app, err)
+		return
 	}
 
-	for _, obj := range objs {
-		if gitRegex.MatchString(obj) {
-			log.Info("Cleaner deleting slug %s for app %s", obj, app)
-			if err := storageDriver.Delete(context.Background(), obj); err != nil {
-				return err
+	var toDelete []string
+	for _, d := range decisions {
+		switch {
+		case d.Action != ActionDeleteBuild:
+			log.Debug("Cleaner keeping %s for app %s (%s)", d.Path, app, d.Reason)
+		case opts.DryRun:
+			log.Info("Cleaner would delete %s for app %s (%s, dry run)", d.Path, app, d.Reason)
+		default:
+			log.Info("Cleaner deleting %s for app %s (%s)", d.Path, app, d.Reason)
+			toDelete = append(toDelete, d.Path)
+		}
+	}
+	errs := deletePrefixes(storageDriver, app, "builds beyond the retention policy", toDelete)
+	for _, d := range decisions {
+		if d.Action == ActionDeleteBuild && !opts.DryRun {
+			if err := errs[0]; err != nil {
+				d.Error = err.Error()
+			} else {
+				d.Done = true
 			}
+			errs = errs[1:]
 		}
+		rep.add(d)
 	}
-	return nil
 }
 
-// Run starts the deleted app cleaner. Every pollSleepDuration, it compares the result of nsLister.List with the directories in the top level of gitHome on the local file system.
-// On any error, it uses log messages to output a human readable description of what happened.
-func Run(gitHome string, nsLister k8s.NamespaceLister, fs sys.FS, pollSleepDuration time.Duration, storageDriver storagedriver.StorageDriver) error {
-	for {
-		nsList, err := nsLister.List(api.ListOptions{LabelSelector: labels.Everything(), FieldSelector: fields.Everything()})
-		if err != nil {
-			log.Err("Cleaner error listing namespaces (%s)", err)
-			continue
-		}
+// retainCache deletes the buildpack cache of app if no build used it for opts.Retention.CacheMaxAge,
+// adding the decision to rep. It returns the stats of the cache, and false if app has no cache
+// anymore.
+func retainCache(rep *Report, app string, storageDriver storagedriver.StorageDriver, opts Options, now time.Time) (gitreceive.CacheStats, bool) {
+	stats, ok, err := gitreceive.GetCacheStats(storageDriver, app)
+	if err != nil {
+		log.Err("Cleaner error getting the cache stats of app %s (%s)", app, err)
+		return stats, false
+	}
+	maxAge := opts.Retention.CacheMaxAge
+	if !ok || maxAge <= 0 || now.Sub(stats.LastUsed) <= maxAge {
+		return stats, ok
+	}
 
-		gitDirs, err := localDirs(gitHome, dirHasGitSuffix)
-		if err != nil {
-			log.Err("Cleaner error listing local git directories (%s)", err)
-			continue
+	d := Decision{App: app, Action: ActionDeleteCache, Path: stats.Key, Reason: fmt.Sprintf("cache wasn't used for more than %s", maxAge)}
+	if opts.DryRun {
+		log.Info("Cleaner would delete cache %s for app %s (%s, dry run)", stats.Key, app, d.Reason)
+	} else {
+		log.Info("Cleaner deleting cache %s for app %s (%s)", stats.Key, app, d.Reason)
+		if err := storageDriver.Delete(context.Background(), stats.Key); err != nil {
+			log.Err("Cleaner error deleting cache %s for app %s (%s)", stats.Key, app, err)
+			d.Error = err.Error()
+		} else {
+			d.Done = true
 		}
+	}
+	rep.add(d)
+	return stats, !d.Done
+}
+
+// minErrorWait is the wait before the cleaner tries again after its first error in a row.
+const minErrorWait = time.Second
+
+// nextErrorWait returns the wait before trying again after an error, doubling the last wait up to
+// max.
+func nextErrorWait(last, max time.Duration) time.Duration {
+	next := 2 * last
+	if next < minErrorWait {
+		next = minErrorWait
+	}
+	if next > max {
+		next = max
+	}
+	return next
+}
 
-		gitDirs = stripSuffixes(gitDirs, dotGitSuffix)
+// clean runs the cleaner once over the apps with local repositories in gitDirs, deleting those
+// that have been missing from apps for the grace period tracked by grace and, if retain is true,
+// holding the builds and caches of the others to opts.Retention and gathering their cache stats.
+// It returns the report of the run.
+func clean(gitHome string, apps []string, gitDirs []string, grace *graceTracker, fs sys.FS, storageDriver storagedriver.StorageDriver, releases ReleaseGetter, opts Options, retain bool, now time.Time) *Report {
+	rep := &Report{Started: now, DryRun: opts.DryRun, Apps: len(gitDirs)}
+	appsToDelete, waiting := grace.update(getDiff(apps, gitDirs), now)
+	deleted := make(map[string]struct{}, len(appsToDelete)+len(waiting))
 
-		appsToDelete := getDiff(nsList.Items, gitDirs)
+	for _, app := range waiting {
+		deleted[app] = struct{}{}
+		rep.add(Decision{App: app, Action: ActionWaitApp, Reason: "app not found, waiting for the grace period to end"})
+	}
+	switch {
+	case len(apps) == 0 && len(appsToDelete) > 0:
+		// an empty app list, such as from a namespace selector that matches no namespace, is much
+		// more likely to be wrong than every app to be gone.
+		rep.Aborted = "no app exists"
+		if opts.AppSource == AppSourceNamespaces && opts.NamespaceSelector != nil {
+			rep.Aborted = fmt.Sprintf("no namespace matches the namespace selector %q", opts.NamespaceSelector.String())
+		}
+	case opts.exceedsThreshold(len(appsToDelete), len(gitDirs)):
+		rep.Aborted = fmt.Sprintf("%d of %d apps would be deleted, more than the %d%% allowed", len(appsToDelete), len(gitDirs), opts.MaxDeletePercent)
+	}
+	if rep.Aborted != "" {
+		log.Err("Cleaner not deleting any apps, since %s", rep.Aborted)
+	}
+	// the index is built the first time it's needed, and only once.
+	var idx objectIndex
+	var idxErr error
+	index := func() (objectIndex, error) {
+		if idx == nil && idxErr == nil {
+			idx, idxErr = indexObjects(storageDriver)
+		}
+		return idx, idxErr
+	}
 
-		for _, appToDelete := range appsToDelete {
+	for _, appToDelete := range appsToDelete {
+		deleted[appToDelete] = struct{}{}
+		d := Decision{App: appToDelete, Action: ActionDeleteApp, Reason: "app not found"}
+		switch {
+		case rep.Aborted != "":
+		case opts.DryRun:
+			log.Info("Cleaner would delete app %s (dry run)", appToDelete)
+		default:
+			var errs []string
 			dirToDelete := filepath.Join(gitHome, appToDelete+dotGitSuffix)
 			if err := fs.RemoveAll(dirToDelete); err != nil {
 				log.Err("Cleaner error removing local files for deleted app %s (%s)", dirToDelete, err)
+				errs = append(errs, err.Error())
 			}
-			if err := deleteFromObjectStore(appToDelete, storageDriver); err != nil {
+			if idx, err := index(); err != nil {
 				log.Err("Cleaner error removing object store files for deleted app %s (%s)", appToDelete, err)
+				errs = append(errs, err.Error())
+			} else if err := deleteFromObjectStore(appToDelete, storageDriver, idx); err != nil {
+				log.Err("Cleaner error removing object store files for deleted app %s (%s)", appToDelete, err)
+				errs = append(errs, err.Error())
+			}
+			d.Done, d.Error = len(errs) == 0, strings.Join(errs, "; ")
+			if d.Done {
+				grace.forget(appToDelete)
 			}
 		}
+		rep.add(d)
+	}
 
-		time.Sleep(pollSleepDuration)
+	if retain {
+		rep.Caches = []gitreceive.CacheStats{}
+		for _, app := range gitDirs {
+			app = strings.ToLower(app)
+			if _, ok := deleted[app]; ok {
+				continue
+			}
+			if opts.Retention.Enabled() {
+				if idx, err := index(); err != nil {
+					log.Err("Cleaner error enforcing the retention policy for app %s (%s)", app, err)
+				} else {
+					retainBuilds(rep, app, storageDriver, releases, opts, now, idx[app])
+				}
+			}
+			if stats, ok := retainCache(rep, app, storageDriver, opts, now); ok {
+				rep.Caches = append(rep.Caches, stats)
+			}
+		}
 	}
+
+	rep.Finished = time.Now()
+	return rep
 }
@@ -1,22 +1,29 @@
 package cleaner
 
 import (
+	"errors"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/arschles/assert"
+	"github.com/deis/builder/pkg/k8s"
+	"github.com/deis/builder/pkg/sys"
 	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/labels"
 )
 
+var errTest = errors.New("test error")
+
 func TestGetDiff(t *testing.T) {
-	nsList := []api.Namespace{
-		{ObjectMeta: api.ObjectMeta{Name: "app1"}},
-		{ObjectMeta: api.ObjectMeta{Name: "app2"}},
-	}
+	apps := []string{"app1", "app2"}
 	dirList := []string{"app1", "app3"}
-	diff := getDiff(nsList, dirList)
+	diff := getDiff(apps, dirList)
 	assert.Equal(t, len(diff), 1, "number of items in the disjunction")
 }
 
@@ -79,3 +86,168 @@ func TestStripSuffixes(t *testing.T) {
 		assert.False(t, strings.HasSuffix(str, dotGitSuffix), "string %s has suffix %s", str, dotGitSuffix)
 	}
 }
+
+func TestClean(t *testing.T) {
+	now := time.Now()
+	apps := []string{"myapp"}
+	gitDirs := []string{"myapp", "otherapp"}
+	newFS := func() *sys.FakeFS {
+		fs := sys.NewFakeFS()
+		fs.Files["/home/git/myapp.git"] = []byte{}
+		fs.Files["/home/git/otherapp.git"] = []byte{}
+		return fs
+	}
+	opts := Options{Retention: RetentionPolicy{KeepBuilds: 3}}
+
+	fs, driver := newFS(), newRetentionDriver(now)
+	rep := clean("/home/git", apps, gitDirs, newGraceTracker(0), fs, driver, fakeReleases{}, opts, true, now)
+	assert.Equal(t, rep.Aborted, "", "abort reason")
+	assert.Equal(t, rep.Apps, 2, "number of apps")
+	assert.Equal(t, len(rep.Decisions), 2, "number of decisions")
+	assert.Equal(t, rep.Decisions[0], Decision{App: "otherapp", Action: ActionDeleteApp, Reason: "app not found", Done: true}, "app decision")
+	assert.Equal(t, rep.Decisions[1].Path, "/home/myapp:git-00000001", "deleted build")
+	assert.True(t, rep.Decisions[1].Done, "expected the build to be deleted")
+	_, ok := fs.Files["/home/git/otherapp.git"]
+	assert.False(t, ok, "the repository of the deleted app exists")
+	_, ok = driver.objs["/home/otherapp:git-00000001/push/slug.tgz"]
+	assert.False(t, ok, "the slug of the deleted app exists")
+	_, ok = driver.objs["/home/myapp:git-00000001/push/slug.tgz"]
+	assert.False(t, ok, "the slug beyond the retention policy exists")
+
+	opts.DryRun = true
+	fs, driver = newFS(), newRetentionDriver(now)
+	rep = clean("/home/git", apps, gitDirs, newGraceTracker(0), fs, driver, fakeReleases{}, opts, true, now)
+	assert.True(t, rep.DryRun, "expected a dry run report")
+	assert.Equal(t, len(rep.Decisions), 2, "number of decisions")
+	for _, d := range rep.Decisions {
+		assert.False(t, d.Done, "decision %+v was carried out in a dry run", d)
+	}
+	assert.Equal(t, len(fs.Files), 2, "number of local repositories after a dry run")
+	assert.Equal(t, len(driver.objs), len(newRetentionDriver(now).objs), "number of objects after a dry run")
+}
+
+func TestCleanThreshold(t *testing.T) {
+	now := time.Now()
+	fs := sys.NewFakeFS()
+	gitDirs := []string{"app1", "app2", "app3", "app4"}
+	for _, dir := range gitDirs {
+		fs.Files["/home/git/"+dir+".git"] = []byte{}
+	}
+	driver := &fakeDriver{objs: map[string]time.Time{}}
+	opts := Options{MaxDeletePercent: 50}
+
+	// an empty app list would remove every app.
+	rep := clean("/home/git", nil, gitDirs, newGraceTracker(0), fs, driver, fakeReleases{}, opts, false, now)
+	assert.True(t, rep.Aborted != "", "expected the run to be aborted")
+	assert.Equal(t, len(rep.Decisions), 4, "number of decisions")
+	for _, d := range rep.Decisions {
+		assert.False(t, d.Done, "decision %+v was carried out in an aborted run", d)
+	}
+	assert.Equal(t, len(fs.Files), 4, "number of local repositories after an aborted run")
+
+	apps := []string{"app1", "app2"}
+	rep = clean("/home/git", apps, gitDirs, newGraceTracker(0), fs, driver, fakeReleases{}, opts, false, now)
+	assert.Equal(t, rep.Aborted, "", "abort reason")
+	assert.Equal(t, len(fs.Files), 2, "number of local repositories")
+}
+
+func TestCleanNoApps(t *testing.T) {
+	now := time.Now()
+	fs := sys.NewFakeFS()
+	fs.Files["/home/git/myapp.git"] = []byte{}
+	driver := &fakeDriver{objs: map[string]time.Time{}}
+	selector, err := labels.Parse("heritage=deis")
+	assert.NoErr(t, err)
+	opts := Options{AppSource: AppSourceNamespaces, NamespaceSelector: selector}
+
+	// a selector that matches no namespace makes every app look deleted.
+	rep := clean("/home/git", nil, []string{"myapp"}, newGraceTracker(0), fs, driver, fakeReleases{}, opts, false, now)
+	assert.Equal(t, rep.Aborted, `no namespace matches the namespace selector "heritage=deis"`, "abort reason")
+	assert.Equal(t, len(rep.Decisions), 1, "number of decisions")
+	assert.False(t, rep.Decisions[0].Done, "decision %+v was carried out in an aborted run", rep.Decisions[0])
+	assert.Equal(t, len(fs.Files), 1, "number of local repositories after an aborted run")
+}
+
+func TestExceedsThreshold(t *testing.T) {
+	opts := Options{MaxDeletePercent: 50}
+	assert.False(t, opts.exceedsThreshold(1, 1), "deleting the only app exceeded the threshold")
+	assert.False(t, opts.exceedsThreshold(2, 4), "deleting half of the apps exceeded the threshold")
+	assert.True(t, opts.exceedsThreshold(3, 4), "deleting most apps didn't exceed the threshold")
+	assert.False(t, Options{}.exceedsThreshold(4, 4), "deleting every app exceeded a disabled threshold")
+}
+
+func TestCleanGracePeriod(t *testing.T) {
+	now := time.Now()
+	fs := sys.NewFakeFS()
+	fs.Files["/home/git/myapp.git"] = []byte{}
+	fs.Files["/home/git/otherapp.git"] = []byte{}
+	gitDirs := []string{"myapp", "otherapp"}
+	driver := &fakeDriver{objs: map[string]time.Time{}}
+	grace := newGraceTracker(time.Minute)
+	apps := []string{"myapp"}
+
+	rep := clean("/home/git", apps, gitDirs, grace, fs, driver, fakeReleases{}, Options{}, false, now)
+	assert.Equal(t, len(rep.Decisions), 1, "number of decisions")
+	assert.Equal(t, rep.Decisions[0].Action, ActionWaitApp, "action")
+	assert.Equal(t, len(fs.Files), 2, "number of local repositories during the grace period")
+	left, ok := grace.remaining(now.Add(10 * time.Second))
+	assert.True(t, ok, "expected an app to be waiting")
+	assert.Equal(t, left, 50*time.Second, "time left")
+
+	rep = clean("/home/git", apps, gitDirs, grace, fs, driver, fakeReleases{}, Options{}, false, now.Add(time.Minute))
+	assert.Equal(t, len(rep.Decisions), 1, "number of decisions")
+	assert.Equal(t, rep.Decisions[0].Action, ActionDeleteApp, "action")
+	assert.True(t, rep.Decisions[0].Done, "expected the app to be deleted")
+	assert.Equal(t, len(fs.Files), 1, "number of local repositories after the grace period")
+	_, ok = grace.remaining(now.Add(time.Minute))
+	assert.False(t, ok, "expected no app to be waiting")
+}
+
+func TestGraceTrackerReappear(t *testing.T) {
+	now := time.Now()
+	grace := newGraceTracker(time.Minute)
+	expired, waiting := grace.update([]string{"myapp"}, now)
+	assert.Equal(t, len(expired), 0, "number of expired apps")
+	assert.Equal(t, len(waiting), 1, "number of waiting apps")
+
+	// the namespace came back, so the grace period starts over the next time it's missing.
+	expired, waiting = grace.update(nil, now.Add(30*time.Second))
+	assert.Equal(t, len(expired)+len(waiting), 0, "number of missing apps")
+	expired, waiting = grace.update([]string{"myapp"}, now.Add(time.Minute))
+	assert.Equal(t, len(expired), 0, "number of expired apps")
+	assert.Equal(t, len(waiting), 1, "number of waiting apps")
+}
+
+func TestNextErrorWait(t *testing.T) {
+	wait := time.Duration(0)
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		wait = nextErrorWait(wait, 5*time.Second)
+		assert.Equal(t, wait, expected, "wait")
+	}
+}
+
+func TestListApps(t *testing.T) {
+	gitHome, err := ioutil.TempDir("", "cleaner")
+	assert.NoErr(t, err)
+	defer os.RemoveAll(gitHome)
+	for _, dir := range []string{"myapp.git", "otherapp.git"} {
+		assert.NoErr(t, os.Mkdir(filepath.Join(gitHome, dir), 0755))
+	}
+
+	nw := &k8s.NamespaceWatcher{Store: cache.NewStore(cache.MetaNamespaceKeyFunc)}
+	assert.NoErr(t, nw.Store.Add(&api.Namespace{ObjectMeta: api.ObjectMeta{Name: "myapp"}}))
+	apps, gitDirs, err := listApps(gitHome, nw, fakeReleases{}, AppSourceNamespaces)
+	assert.NoErr(t, err)
+	assert.Equal(t, strings.Join(apps, ","), "myapp", "apps")
+	sort.Strings(gitDirs)
+	assert.Equal(t, strings.Join(gitDirs, ","), "myapp,otherapp", "git directories")
+
+	apps, _, err = listApps(gitHome, nw, fakeReleases{apps: []string{"otherapp"}}, AppSourceController)
+	assert.NoErr(t, err)
+	assert.Equal(t, strings.Join(apps, ","), "otherapp", "apps")
+
+	_, _, err = listApps(gitHome, nw, fakeReleases{err: errTest}, AppSourceController)
+	assert.ExistsErr(t, err, "app list error")
+	_, _, err = listApps(gitHome, nw, fakeReleases{}, "nosuchsource")
+	assert.ExistsErr(t, err, "unknown app source")
+}
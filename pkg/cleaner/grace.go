@@ -0,0 +1,59 @@
+package cleaner
+
+import (
+	"time"
+)
+
+// graceTracker remembers since when the namespaces of apps have been missing, so that the data of
+// an app is only purged once its namespace has been gone for the whole grace period.
+type graceTracker struct {
+	period       time.Duration
+	missingSince map[string]time.Time
+}
+
+func newGraceTracker(period time.Duration) *graceTracker {
+	return &graceTracker{period: period, missingSince: make(map[string]time.Time)}
+}
+
+// update records that the namespaces of the apps in missing are missing at now, and forgets the
+// apps that aren't missing anymore. It returns the apps whose grace period is over, and those
+// still waiting for it to end.
+func (g *graceTracker) update(missing []string, now time.Time) (expired, waiting []string) {
+	stillMissing := make(map[string]time.Time, len(missing))
+	for _, app := range missing {
+		since, ok := g.missingSince[app]
+		if !ok {
+			since = now
+		}
+		stillMissing[app] = since
+		if now.Sub(since) >= g.period {
+			expired = append(expired, app)
+		} else {
+			waiting = append(waiting, app)
+		}
+	}
+	g.missingSince = stillMissing
+	return expired, waiting
+}
+
+// forget stops tracking app, after its data was purged.
+func (g *graceTracker) forget(app string) {
+	delete(g.missingSince, app)
+}
+
+// remaining returns the time left at now before the grace period of the app missing the longest
+// ends, and false if no app is waiting for it.
+func (g *graceTracker) remaining(now time.Time) (time.Duration, bool) {
+	var min time.Duration
+	found := false
+	for _, since := range g.missingSince {
+		left := g.period - now.Sub(since)
+		if left <= 0 {
+			continue
+		}
+		if !found || left < min {
+			min, found = left, true
+		}
+	}
+	return min, found
+}
@@ -0,0 +1,94 @@
+package cleaner
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/deis/pkg/log"
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+const (
+	// homePrefix is the prefix that every app's builds are stored under.
+	homePrefix = "home"
+	// deleteBatchSize is the number of prefixes deleted at the same time.
+	deleteBatchSize = 16
+)
+
+// objectIndex maps every app to the build prefixes it has under homePrefix, which are named
+// home/<app>:<build>. List returns them with a leading /, and so does the index.
+type objectIndex map[string][]string
+
+// indexObjects lists homePrefix once and groups the build prefixes in it by app. Listing once per
+// cleaner run keeps the time it takes proportional to the number of builds, whatever the number of
+// apps being cleaned.
+func indexObjects(storageDriver storagedriver.StorageDriver) (objectIndex, error) {
+	objs, err := storageDriver.List(context.Background(), homePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("listing %s (%s)", homePrefix, err)
+	}
+	idx := objectIndex{}
+	for _, obj := range objs {
+		name := strings.TrimPrefix(strings.TrimPrefix(obj, "/"), homePrefix+"/")
+		// home/<app> holds the cache of the app rather than a build.
+		if i := strings.IndexByte(name, ':'); i > 0 {
+			app := strings.ToLower(name[:i])
+			idx[app] = append(idx[app], obj)
+		}
+	}
+	return idx, nil
+}
+
+// deletePrefixes deletes prefixes of app, each with everything under it, deleteBatchSize at a
+// time, logging progress after every batch. It returns the error deleting each prefix, in the
+// same order as prefixes.
+func deletePrefixes(storageDriver storagedriver.StorageDriver, app, what string, prefixes []string) []error {
+	errs := make([]error, len(prefixes))
+	failed := 0
+	for start := 0; start < len(prefixes); start += deleteBatchSize {
+		end := start + deleteBatchSize
+		if end > len(prefixes) {
+			end = len(prefixes)
+		}
+
+		var wg sync.WaitGroup
+		for i := start; i < end; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = storageDriver.Delete(context.Background(), prefixes[i])
+			}(i)
+		}
+		wg.Wait()
+
+		for i := start; i < end; i++ {
+			if errs[i] != nil {
+				log.Err("Cleaner error deleting %s for app %s (%s)", prefixes[i], app, errs[i])
+				failed++
+			}
+		}
+		log.Info("Cleaner deleted %d of %d %s for app %s", end-failed, len(prefixes), what, app)
+	}
+	return errs
+}
+
+// firstError summarizes errs, returned by deletePrefixes, in a single error, or returns nil if
+// all deletes succeeded.
+func firstError(errs []error, what string) error {
+	var first error
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			failed++
+		}
+	}
+	if first == nil {
+		return nil
+	}
+	return fmt.Errorf("%d of %d %s weren't deleted (%s)", failed, len(errs), what, first)
+}
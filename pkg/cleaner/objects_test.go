@@ -0,0 +1,70 @@
+package cleaner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arschles/assert"
+)
+
+func TestIndexObjects(t *testing.T) {
+	driver := newRetentionDriver(time.Now())
+	idx, err := indexObjects(driver)
+	assert.NoErr(t, err)
+	assert.Equal(t, len(idx), 2, "number of apps")
+	sort.Strings(idx["myapp"])
+	assert.Equal(t, strings.Join(idx["myapp"], ","), strings.Join([]string{
+		"/home/myapp:git-00000001",
+		"/home/myapp:git-00000002",
+		"/home/myapp:git-00000003",
+		"/home/myapp:git-00000004",
+		"/home/myapp:git-00000005",
+		"/home/myapp:tree-" + testTree,
+		"/home/myapp:tree-" + strings.Repeat("a", 40),
+	}, ","), "prefixes of myapp")
+	assert.Equal(t, strings.Join(idx["otherapp"], ","), "/home/otherapp:git-00000001", "prefixes of otherapp")
+}
+
+func TestDeleteFromObjectStore(t *testing.T) {
+	driver := newRetentionDriver(time.Now())
+	idx, err := indexObjects(driver)
+	assert.NoErr(t, err)
+	assert.NoErr(t, deleteFromObjectStore("myapp", driver, idx))
+	for key := range driver.objs {
+		if strings.HasPrefix(key, "/home/myapp:") {
+			t.Errorf("expected %s to be deleted", key)
+		}
+	}
+	_, ok := driver.objs["/home/otherapp:git-00000001/push/slug.tgz"]
+	assert.True(t, ok, "the slug of another app was deleted")
+}
+
+func TestDeletePrefixes(t *testing.T) {
+	driver := &fakeDriver{objs: map[string]time.Time{}, deleteErr: map[string]error{}}
+	var prefixes []string
+	for i := 0; i < 2*deleteBatchSize+1; i++ {
+		prefix := fmt.Sprintf("/home/myapp:git-%08d", i)
+		driver.objs[prefix+"/push/slug.tgz"] = time.Now()
+		prefixes = append(prefixes, prefix)
+	}
+	driver.deleteErr[prefixes[deleteBatchSize]] = errTest
+
+	errs := deletePrefixes(driver, "myapp", "builds", prefixes)
+	assert.Equal(t, len(errs), len(prefixes), "number of errors")
+	for i, err := range errs {
+		if i == deleteBatchSize {
+			assert.Equal(t, err, errTest, "error")
+		} else {
+			assert.NoErr(t, err)
+		}
+	}
+	assert.Equal(t, len(driver.objs), 1, "number of objects left")
+	err := firstError(errs, "builds")
+	assert.ExistsErr(t, err, "delete error")
+	expected := fmt.Sprintf("1 of %d builds weren't deleted", len(prefixes))
+	assert.True(t, strings.HasPrefix(err.Error(), expected), "unexpected error %s", err)
+	assert.NoErr(t, firstError(make([]error, 3), "builds"))
+}
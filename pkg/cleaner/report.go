@@ -0,0 +1,96 @@
+package cleaner
+
+import (
+	"sync"
+	"time"
+
+	"github.com/deis/builder/pkg/gitreceive"
+)
+
+// The actions a Decision can take.
+const (
+	// ActionDeleteApp deletes the local repository and stored files of an app that no longer exists.
+	ActionDeleteApp = "delete-app"
+	// ActionWaitApp keeps the data of an app that no longer exists until its grace period ends.
+	ActionWaitApp = "wait-app"
+	// ActionDeleteBuild deletes a build that's beyond the retention policy.
+	ActionDeleteBuild = "delete-build"
+	// ActionKeepBuild keeps a build that's beyond the retention policy, since it's still in use.
+	ActionKeepBuild = "keep-build"
+	// ActionDeleteCache deletes a buildpack cache that no build used for too long.
+	ActionDeleteCache = "delete-cache"
+)
+
+// Decision is what a cleaner run decided to do about an app or one of its builds.
+type Decision struct {
+	App    string `json:"app"`
+	Action string `json:"action"`
+	// Path is the object storage prefix of the build the decision is about, if any.
+	Path   string `json:"path,omitempty"`
+	Reason string `json:"reason"`
+	// Done is true if the action was carried out, which it never is in a dry run.
+	Done  bool   `json:"done"`
+	Error string `json:"error,omitempty"`
+}
+
+// Report is the record of a single cleaner run.
+type Report struct {
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	DryRun   bool      `json:"dryRun"`
+	// Apps is the number of apps with a local repository when the run started.
+	Apps int `json:"apps"`
+	// Aborted is the reason the run deleted no apps, if the safety threshold stopped it.
+	Aborted   string     `json:"aborted,omitempty"`
+	Decisions []Decision `json:"decisions"`
+	// Caches holds the stats of the buildpack caches of the remaining apps, if the run gathered
+	// them.
+	Caches []gitreceive.CacheStats `json:"caches,omitempty"`
+}
+
+func (r *Report) add(d Decision) {
+	r.Decisions = append(r.Decisions, d)
+}
+
+// Reports holds the report of the last finished cleaner run, and the buildpack cache stats the
+// cleaner last gathered. It's safe for concurrent use.
+type Reports struct {
+	mut    sync.RWMutex
+	last   *Report
+	caches []gitreceive.CacheStats
+}
+
+// NewReports creates a Reports without any report.
+func NewReports() *Reports {
+	return &Reports{}
+}
+
+// Last returns the report of the last finished run, and false if no run finished yet.
+func (r *Reports) Last() (Report, bool) {
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+	if r.last == nil {
+		return Report{}, false
+	}
+	return *r.last, true
+}
+
+func (r *Reports) set(rep *Report) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.last = rep
+}
+
+// Caches returns the stats of the buildpack caches of all apps, and false if the cleaner didn't
+// gather them yet.
+func (r *Reports) Caches() ([]gitreceive.CacheStats, bool) {
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+	return r.caches, r.caches != nil
+}
+
+func (r *Reports) setCaches(caches []gitreceive.CacheStats) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.caches = caches
+}
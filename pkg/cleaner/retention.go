@@ -0,0 +1,144 @@
+package cleaner
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deis/builder/pkg/gitreceive"
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+// RetentionPolicy is the number and age of the builds the cleaner keeps for every app. A zero
+// field puts no limit on its own; a build is deleted when it's beyond either limit that's set.
+type RetentionPolicy struct {
+	// KeepBuilds is the number of most recent builds kept.
+	KeepBuilds int
+	// MaxAge is the age after which builds are deleted.
+	MaxAge time.Duration
+	// CacheMaxAge is the time after which a buildpack cache that no build wrote is deleted.
+	CacheMaxAge time.Duration
+	// Interval is the time between two runs of the policy over every app, which also gather the
+	// stats of their buildpack caches. It's much longer than the time between looks for deleted
+	// apps, since it asks the controller and object storage about every app.
+	Interval time.Duration
+}
+
+// Enabled returns true if p limits the builds kept at all.
+func (p RetentionPolicy) Enabled() bool {
+	return p.KeepBuilds > 0 || p.MaxAge > 0
+}
+
+// expired returns true if the build that's the i-th most recent, counting from 0, and was stored
+// at modTime is beyond p at now.
+func (p RetentionPolicy) expired(i int, modTime, now time.Time) bool {
+	if p.KeepBuilds > 0 && i >= p.KeepBuilds {
+		return true
+	}
+	return p.MaxAge > 0 && now.Sub(modTime) > p.MaxAge
+}
+
+// ReleaseGetter reports the image of the build that an app's current release runs. For buildpack
+// builds, that's the object storage key of the slug.
+type ReleaseGetter interface {
+	CurrentImage(app string) (string, error)
+}
+
+// storedBuild is a prefix in object storage holding the files of one build.
+type storedBuild struct {
+	prefix  string
+	modTime time.Time
+}
+
+// retentionDecisions decides which of the build prefixes of app to delete, according to policy at
+// now. The slug of the current release, as reported by releases, is never deleted, whatever its
+// age.
+//
+// Source tarballs are kept under their own prefixes, by git tree, and are held to the same policy
+// separately. Deleting one only means that a later push of the same tree uploads it again. Trees
+// and slugs that pushes reuse are dated by their last use, so that they're not deleted while a
+// build uses them.
+func retentionDecisions(app string, storageDriver storagedriver.StorageDriver, releases ReleaseGetter, policy RetentionPolicy, now time.Time, prefixes []string) ([]Decision, error) {
+	current, err := releases.CurrentImage(app)
+	if err != nil {
+		return nil, fmt.Errorf("getting the current release (%s)", err)
+	}
+
+	// regexes need prepended / to match output of List()
+	gitRegex := regexp.MustCompile(`^/` + fmt.Sprintf(gitreceive.GitKeyPattern, regexp.QuoteMeta(app), ".{8}") + "$")
+	treeRegex := regexp.MustCompile(`^/` + fmt.Sprintf(gitreceive.TreeKeyPattern, regexp.QuoteMeta(app), "[0-9a-f]{40}") + "$")
+
+	var slugs, trees []string
+	for _, obj := range prefixes {
+		switch {
+		case gitRegex.MatchString(obj):
+			slugs = append(slugs, obj)
+		case treeRegex.MatchString(obj):
+			trees = append(trees, obj)
+		}
+	}
+
+	var decisions []Decision
+	slugBuilds, err := statBuilds(storageDriver, slugs, "/push/slug.tgz")
+	if err != nil {
+		return nil, err
+	}
+	for i, build := range slugBuilds {
+		if !policy.expired(i, build.modTime, now) {
+			continue
+		}
+		d := Decision{App: app, Action: ActionDeleteBuild, Path: build.prefix, Reason: "slug is beyond the retention policy"}
+		if current != "" && strings.HasPrefix("/"+strings.TrimPrefix(current, "/"), build.prefix+"/") {
+			d.Action, d.Reason = ActionKeepBuild, "slug is beyond the retention policy, but the current release runs it"
+		}
+		decisions = append(decisions, d)
+	}
+
+	treeBuilds, err := statBuilds(storageDriver, trees, "/tar")
+	if err != nil {
+		return nil, err
+	}
+	for i, build := range treeBuilds {
+		if policy.expired(i, build.modTime, now) {
+			decisions = append(decisions, Decision{App: app, Action: ActionDeleteBuild, Path: build.prefix, Reason: "source is beyond the retention policy"})
+		}
+	}
+	return decisions, nil
+}
+
+// statBuilds returns the builds at prefixes, newest first, dated by the object at suffix under
+// each prefix, or by their used marker if a later push reused them since. Builds without the
+// object at suffix may still be running, so they're left out.
+func statBuilds(storageDriver storagedriver.StorageDriver, prefixes []string, suffix string) ([]storedBuild, error) {
+	builds := make([]storedBuild, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		info, err := storageDriver.Stat(context.Background(), prefix+suffix)
+		if err != nil {
+			if _, ok := err.(storagedriver.PathNotFoundError); ok {
+				continue
+			}
+			return nil, err
+		}
+		build := storedBuild{prefix: prefix, modTime: info.ModTime()}
+		used, err := storageDriver.Stat(context.Background(), prefix+"/"+gitreceive.UsedMarkerName)
+		if err == nil {
+			if used.ModTime().After(build.modTime) {
+				build.modTime = used.ModTime()
+			}
+		} else if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+			return nil, err
+		}
+		builds = append(builds, build)
+	}
+	sort.Sort(byNewest(builds))
+	return builds, nil
+}
+
+type byNewest []storedBuild
+
+func (b byNewest) Len() int           { return len(b) }
+func (b byNewest) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byNewest) Less(i, j int) bool { return b[i].modTime.After(b[j].modTime) }
@@ -0,0 +1,215 @@
+package cleaner
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arschles/assert"
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+const testTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// fakeDriver is a storage driver holding objects and their modification times, which accepts the
+// keys the builder uses. Only List, Stat and Delete are implemented. It's safe for concurrent use.
+type fakeDriver struct {
+	storagedriver.StorageDriver
+	mut  sync.Mutex
+	objs map[string]time.Time
+	// deleteErr, if set, is returned by Delete for the paths it contains.
+	deleteErr map[string]error
+}
+
+func (d *fakeDriver) List(ctx context.Context, path string) ([]string, error) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	prefix := "/" + strings.Trim(path, "/") + "/"
+	set := map[string]struct{}{}
+	for key := range d.objs {
+		if strings.HasPrefix(key, prefix) {
+			set[prefix+strings.SplitN(strings.TrimPrefix(key, prefix), "/", 2)[0]] = struct{}{}
+		}
+	}
+	var ret []string
+	for key := range set {
+		ret = append(ret, key)
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+func (d *fakeDriver) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	modTime, ok := d.objs[path]
+	if !ok {
+		return nil, storagedriver.PathNotFoundError{Path: path}
+	}
+	return storagedriver.FileInfoInternal{FileInfoFields: storagedriver.FileInfoFields{Path: path, ModTime: modTime}}, nil
+}
+
+func (d *fakeDriver) Delete(ctx context.Context, path string) error {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	if err, ok := d.deleteErr[path]; ok {
+		return err
+	}
+	for key := range d.objs {
+		if key == path || strings.HasPrefix(key, path+"/") {
+			delete(d.objs, key)
+		}
+	}
+	return nil
+}
+
+// fakeReleases is a Controller with a single current image for every app.
+type fakeReleases struct {
+	image string
+	apps  []string
+	err   error
+}
+
+func (r fakeReleases) CurrentImage(app string) (string, error) {
+	return r.image, r.err
+}
+
+func (r fakeReleases) AppIDs() ([]string, error) {
+	return r.apps, r.err
+}
+
+// newRetentionDriver returns a driver with the slugs of 4 builds of myapp, a day apart, built from
+// 2 trees, a build of another app and a build that's still running.
+func newRetentionDriver(now time.Time) *fakeDriver {
+	day := 24 * time.Hour
+	return &fakeDriver{objs: map[string]time.Time{
+		"/home/myapp:git-00000001/push/slug.tgz":               now.Add(-4 * day),
+		"/home/myapp:git-00000001/push/Procfile":               now.Add(-4 * day),
+		"/home/myapp:git-00000002/push/slug.tgz":               now.Add(-3 * day),
+		"/home/myapp:git-00000003/push/slug.tgz":               now.Add(-2 * day),
+		"/home/myapp:git-00000004/push/slug.tgz":               now.Add(-1 * day),
+		"/home/myapp:git-00000005/push/Procfile":               now,
+		"/home/myapp:tree-" + testTree + "/tar":                now.Add(-4 * day),
+		"/home/myapp:tree-" + strings.Repeat("a", 40) + "/tar": now.Add(-1 * day),
+		"/home/myapp/cache":                                    now.Add(-1 * day),
+		"/home/otherapp:git-00000001/push/slug.tgz":            now.Add(-10 * day),
+	}}
+}
+
+func TestRetentionDecisions(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+	tests := []struct {
+		name    string
+		policy  RetentionPolicy
+		current string
+		// used are the used markers refreshed by pushes since the builds.
+		used    []string
+		deleted []string
+	}{
+		{
+			name:    "last 2 builds",
+			policy:  RetentionPolicy{KeepBuilds: 2},
+			deleted: []string{"/home/myapp:git-00000001", "/home/myapp:git-00000002"},
+		},
+		{
+			name:    "max age",
+			policy:  RetentionPolicy{MaxAge: 2*day + time.Hour},
+			deleted: []string{"/home/myapp:git-00000001", "/home/myapp:git-00000002", "/home/myapp:tree-" + testTree},
+		},
+		{
+			name:    "both",
+			policy:  RetentionPolicy{KeepBuilds: 3, MaxAge: 3*day + time.Hour},
+			deleted: []string{"/home/myapp:git-00000001", "/home/myapp:tree-" + testTree},
+		},
+		{
+			name:   "reused tree and slug",
+			policy: RetentionPolicy{MaxAge: 2*day + time.Hour},
+			used: []string{
+				"/home/myapp:tree-" + testTree + "/used",
+				"/home/myapp:git-00000001/used",
+			},
+			deleted: []string{"/home/myapp:git-00000002"},
+		},
+		{
+			name:    "current release is kept",
+			policy:  RetentionPolicy{KeepBuilds: 1},
+			current: "home/myapp:git-00000002/push/slug.tgz",
+			deleted: []string{"/home/myapp:git-00000001", "/home/myapp:git-00000003", "/home/myapp:tree-" + testTree},
+		},
+	}
+
+	for _, test := range tests {
+		driver := newRetentionDriver(now)
+		for _, marker := range test.used {
+			driver.objs[marker] = now.Add(-time.Hour)
+		}
+		before := len(driver.objs)
+		idx, err := indexObjects(driver)
+		assert.NoErr(t, err)
+		decisions, err := retentionDecisions("myapp", driver, fakeReleases{image: test.current}, test.policy, now, idx["myapp"])
+		assert.NoErr(t, err)
+		assert.Equal(t, len(driver.objs), before, "number of objects after deciding")
+
+		var deleted []string
+		for _, d := range decisions {
+			assert.Equal(t, d.App, "myapp", "app")
+			if d.Action == ActionDeleteBuild {
+				deleted = append(deleted, d.Path)
+			} else if !strings.HasPrefix("/"+test.current, d.Path+"/") {
+				t.Errorf("%s: unexpected decision to keep %s", test.name, d.Path)
+			}
+		}
+		sort.Strings(deleted)
+		sort.Strings(test.deleted)
+		assert.Equal(t, strings.Join(deleted, ","), strings.Join(test.deleted, ","), test.name+" deleted builds")
+	}
+}
+
+func TestRetentionDecisionsNoRelease(t *testing.T) {
+	now := time.Now()
+	_, err := retentionDecisions("myapp", newRetentionDriver(now), fakeReleases{err: errors.New("controller unavailable")}, RetentionPolicy{KeepBuilds: 1}, now, nil)
+	assert.ExistsErr(t, err, "current release error")
+}
+
+func TestRetentionPolicyEnabled(t *testing.T) {
+	assert.False(t, RetentionPolicy{Interval: time.Hour}.Enabled(), "policy without limits enabled")
+	assert.True(t, RetentionPolicy{KeepBuilds: 1}.Enabled(), "policy with a build limit disabled")
+	assert.True(t, RetentionPolicy{MaxAge: time.Hour}.Enabled(), "policy with an age limit disabled")
+}
+
+func TestRetainCache(t *testing.T) {
+	now := time.Now()
+	driver := &fakeDriver{objs: map[string]time.Time{
+		"home/myapp/cache":    now.Add(-10 * 24 * time.Hour),
+		"home/otherapp/cache": now.Add(-24 * time.Hour),
+	}}
+	opts := Options{Retention: RetentionPolicy{CacheMaxAge: 7 * 24 * time.Hour}}
+
+	rep := &Report{}
+	_, ok := retainCache(rep, "otherapp", driver, opts, now)
+	assert.True(t, ok, "expected a recently used cache to be kept")
+	assert.Equal(t, len(rep.Decisions), 0, "number of decisions")
+
+	opts.DryRun = true
+	_, ok = retainCache(rep, "myapp", driver, opts, now)
+	assert.True(t, ok, "expected the cache to be kept in a dry run")
+	assert.Equal(t, len(rep.Decisions), 1, "number of decisions")
+	assert.False(t, rep.Decisions[0].Done, "cache deleted in a dry run")
+
+	opts.DryRun = false
+	rep = &Report{}
+	_, ok = retainCache(rep, "myapp", driver, opts, now)
+	assert.False(t, ok, "expected an expired cache to be deleted")
+	assert.Equal(t, rep.Decisions[0].Action, ActionDeleteCache, "action")
+	assert.True(t, rep.Decisions[0].Done, "expected the cache to be deleted")
+	_, exists := driver.objs["home/myapp/cache"]
+	assert.False(t, exists, "the expired cache exists")
+
+	_, ok = retainCache(rep, "noapp", driver, opts, now)
+	assert.False(t, ok, "found the cache of an app without one")
+}
@@ -3,6 +3,7 @@ package conf
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
 	"strings"
 
 	"github.com/deis/builder/pkg/sys"
@@ -13,6 +14,12 @@ const (
 	minioHostEnvVar     = "DEIS_MINIO_SERVICE_HOST"
 	minioPortEnvVar     = "DEIS_MINIO_SERVICE_PORT"
 	gcsKey              = "key.json"
+
+	storageTypeEnvVar    = "BUILDER_STORAGE"
+	filesystemRootEnvVar = "BUILDER_STORAGE_ROOT_DIRECTORY"
+	// defaultFilesystemRoot is where the filesystem backend keeps its objects unless
+	// BUILDER_STORAGE_ROOT_DIRECTORY says otherwise.
+	defaultFilesystemRoot = "/tmp/deis-builder-storage"
 )
 
 // BuilderKeyLocation holds the path of the builder key secret.
@@ -31,8 +38,17 @@ func GetBuilderKey() (string, error) {
 	return builderKey, nil
 }
 
-// GetStorageParams returns the credentials required for connecting to object storage
+// GetStorageParams returns the credentials required for connecting to object storage. The
+// filesystem and inmemory backends don't need any credentials, so their parameters come from the
+// environment alone.
 func GetStorageParams(env sys.Env) (Parameters, error) {
+	switch env.Get(storageTypeEnvVar) {
+	case "filesystem":
+		return getFilesystemParams(env)
+	case "inmemory":
+		return Parameters{}, nil
+	}
+
 	params := make(map[string]interface{})
 	files, err := ioutil.ReadDir(storageCredLocation)
 	if err != nil {
@@ -56,7 +72,7 @@ func GetStorageParams(env sys.Env) (Parameters, error) {
 	}
 	params["bucket"] = params["builder-bucket"]
 	params["container"] = params["builder-container"]
-	if env.Get("BUILDER_STORAGE") == "minio" {
+	if env.Get(storageTypeEnvVar) == "minio" {
 		mHost := env.Get(minioHostEnvVar)
 		mPort := env.Get(minioPortEnvVar)
 		params["regionendpoint"] = fmt.Sprintf("http://%s:%s", mHost, mPort)
@@ -67,3 +83,16 @@ func GetStorageParams(env sys.Env) (Parameters, error) {
 
 	return params, nil
 }
+
+// getFilesystemParams returns the parameters of the filesystem backend, creating its root
+// directory if need be so that listing an empty store succeeds.
+func getFilesystemParams(env sys.Env) (Parameters, error) {
+	root := env.Get(filesystemRootEnvVar)
+	if root == "" {
+		root = defaultFilesystemRoot
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("creating storage root directory %s (%s)", root, err)
+	}
+	return Parameters{"rootdirectory": root}, nil
+}
@@ -82,6 +82,33 @@ func TestGetStorageParams(t *testing.T) {
 	assert.Equal(t, params["bucket"], "git", "bucket")
 }
 
+func TestGetStorageParamsFilesystem(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "tmpdir")
+	assert.NoErr(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	root := filepath.Join(tmpDir, "storage", "root")
+	env := sys.NewFakeEnv()
+	env.Envs = map[string]string{
+		"BUILDER_STORAGE":                "filesystem",
+		"BUILDER_STORAGE_ROOT_DIRECTORY": root,
+	}
+	params, err := GetStorageParams(env)
+	assert.NoErr(t, err)
+	assert.Equal(t, params, Parameters{"rootdirectory": root}, "storage params")
+	info, err := os.Stat(root)
+	assert.NoErr(t, err)
+	assert.True(t, info.IsDir(), "expected %s to be created as a directory", root)
+}
+
+func TestGetStorageParamsInMemory(t *testing.T) {
+	env := sys.NewFakeEnv()
+	env.Envs = map[string]string{"BUILDER_STORAGE": "inmemory"}
+	params, err := GetStorageParams(env)
+	assert.NoErr(t, err)
+	assert.Equal(t, len(params), 0, "number of storage params")
+}
+
 func TestGetControllerClient(t *testing.T) {
 	tmpDir, err := ioutil.TempDir("", "tmpdir")
 	if err != nil {
@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"fmt"
+
+	deis "github.com/deis/controller-sdk-go"
+	"github.com/deis/controller-sdk-go/apps"
+	"github.com/deis/controller-sdk-go/builds"
+	"github.com/deis/controller-sdk-go/releases"
+)
+
+const (
+	// appResults is the number of apps asked for in the first page of the app list.
+	appResults = 100
+	// buildResults is the number of an app's most recent builds searched for the build of its
+	// current release.
+	buildResults = 100
+)
+
+// Admin asks the controller about every app. The controller only shows apps and their releases
+// to users, so it needs the token of a user that can see every app, such as an admin.
+type Admin struct {
+	client *deis.Client
+}
+
+// NewAdmin creates an Admin that asks the controller at host and port, authenticating with token.
+func NewAdmin(host, port, token string) (*Admin, error) {
+	client, err := deis.New(true, fmt.Sprintf("http://%s:%s/", host, port), token)
+	if err != nil {
+		return nil, err
+	}
+	client.UserAgent = "deis-builder"
+	return &Admin{client: client}, nil
+}
+
+// AppIDs returns the IDs of all apps.
+func (a *Admin) AppIDs() ([]string, error) {
+	list, count, err := apps.List(a.client, appResults)
+	if err := CheckAPICompat(a.client, err); err != nil {
+		return nil, fmt.Errorf("listing apps (%s)", err)
+	}
+	if count > len(list) {
+		// an app missing from the list would look deleted, so get them all.
+		list, _, err = apps.List(a.client, count)
+		if err := CheckAPICompat(a.client, err); err != nil {
+			return nil, fmt.Errorf("listing apps (%s)", err)
+		}
+		if len(list) < count {
+			return nil, fmt.Errorf("the controller listed %d of %d apps", len(list), count)
+		}
+	}
+	ids := make([]string, len(list))
+	for i, app := range list {
+		ids[i] = app.ID
+	}
+	return ids, nil
+}
+
+// CurrentImage returns the image of the build that the latest release of app runs, which is the
+// object storage key of the slug for buildpack builds. It returns "" if app has no release with a
+// build.
+func (a *Admin) CurrentImage(app string) (string, error) {
+	rels, _, err := releases.List(a.client, app, 1)
+	if err := CheckAPICompat(a.client, err); err != nil {
+		return "", fmt.Errorf("listing releases (%s)", err)
+	}
+	if len(rels) == 0 || rels[0].Build == "" {
+		return "", nil
+	}
+
+	blds, _, err := builds.List(a.client, app, buildResults)
+	if err := CheckAPICompat(a.client, err); err != nil {
+		return "", fmt.Errorf("listing builds (%s)", err)
+	}
+	for _, bld := range blds {
+		if bld.UUID == rels[0].Build {
+			return bld.Image, nil
+		}
+	}
+	return "", fmt.Errorf("build %s of release v%d isn't among the last %d builds", rels[0].Build, rels[0].Version, buildResults)
+}
@@ -24,9 +24,6 @@ import (
 // - .GitHome: the path to Git's home directory
 const preReceiveHookTplStr = `#!/bin/bash
 set -eo pipefail
-strip_remote_prefix() {
-    stdbuf -i0 -o0 -e0 sed "s/^/"$'\e[1G'"/"
-}
 
 GIT_HOME={{.GitHome}} \
 SSH_CONNECTION="$SSH_CONNECTION" \
@@ -35,7 +32,7 @@ REPOSITORY="$RECEIVE_REPO" \
 USERNAME="$RECEIVE_USER" \
 FINGERPRINT="$RECEIVE_FINGERPRINT" \
 POD_NAMESPACE="$POD_NAMESPACE" \
-boot git-receive | strip_remote_prefix
+boot git-receive
 `
 
 var preReceiveHookTpl = template.Must(template.New("hooks").Parse(preReceiveHookTplStr))
@@ -61,6 +58,11 @@ func Receive(
 		return err
 	}
 
+	if err := configureRepo(repoPath); err != nil {
+		err = fmt.Errorf("Did not configure repo (%s)", err)
+		return err
+	}
+
 	log.Info("writing pre-receive hook under %s", repoPath)
 	if err := createPreReceiveHook(gitHome, repoPath); err != nil {
 		err = fmt.Errorf("Did not write pre-receive hook (%s)", err)
@@ -155,6 +157,18 @@ func createRepo(repoPath string) (bool, error) {
 	return false, err
 }
 
+// configureRepo sets the git config that the builder relies on in the repo at repoPath. It's run
+// on every receive so that repos created by older builders pick up new settings.
+func configureRepo(repoPath string) error {
+	// let clients pass options to the build with `git push -o <option>`
+	cmd := exec.Command("git", "config", "receive.advertisePushOptions", "true")
+	cmd.Dir = repoPath
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s (%s)", strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
+
 // createPreReceiveHook renders preReceiveHookTpl to repoPath/hooks/pre-receive
 func createPreReceiveHook(gitHome, repoPath string) error {
 	writePath := filepath.Join(repoPath, "hooks", "pre-receive")
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -22,3 +23,20 @@ func TestCreatePreReceiveHook(t *testing.T) {
 	gitHomeIdx := strings.Index(hookStr, fmt.Sprintf("GIT_HOME=%s", gitHome))
 	assert.False(t, gitHomeIdx == -1, "GIT_HOME was not found")
 }
+
+func TestConfigureRepo(t *testing.T) {
+	repoPath, err := ioutil.TempDir("", "configure-repo")
+	assert.NoErr(t, err)
+	defer os.RemoveAll(repoPath)
+
+	initCmd := exec.Command("git", "init", "--bare")
+	initCmd.Dir = repoPath
+	assert.NoErr(t, initCmd.Run())
+	assert.NoErr(t, configureRepo(repoPath))
+
+	getCmd := exec.Command("git", "config", "receive.advertisePushOptions")
+	getCmd.Dir = repoPath
+	out, err := getCmd.Output()
+	assert.NoErr(t, err)
+	assert.Equal(t, strings.TrimSpace(string(out)), "true", "receive.advertisePushOptions")
+}
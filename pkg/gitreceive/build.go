@@ -24,6 +24,7 @@ import (
 	"gopkg.in/yaml.v2"
 	"k8s.io/kubernetes/pkg/api"
 	client "k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/labels"
 )
 
 // repoCmd returns exec.Command(first, others...) with its current working directory repoDir
@@ -52,7 +53,19 @@ func build(
 	fs sys.FS,
 	env sys.Env,
 	builderKey,
-	rawGitSha string) error {
+	oldRev,
+	rawGitSha string) (err error) {
+
+	color, colorErr := useColor(conf, getPushOptions(env))
+	out := newProgressWriter(os.Stdout, color)
+	defer func() {
+		if err != nil {
+			out.fail()
+		}
+	}()
+	if colorErr != nil {
+		out.warnf("%s", colorErr)
+	}
 
 	dockerBuilderImagePullPolicy, err := k8s.PullPolicyFromString(conf.DockerBuilderImagePullPolicy)
 	if err != nil {
@@ -110,8 +123,39 @@ func build(
 		}
 	}
 
+	pushOpts := getPushOptions(env)
+	src, err := getBuildSource(appConf.Values, pushOpts)
+	if err != nil {
+		return err
+	}
+
+	// a push that creates the ref has nothing to compare to, so it's always built.
+	if oldSha, err := git.NewSha(oldRev); err == nil && oldRev != zeroRev {
+		globs, err := getWatchPaths(appConf.Values, src)
+		if err != nil {
+			return err
+		}
+		if _, rebuild := pushOpts[pushOptionRebuild]; len(globs) > 0 && !rebuild {
+			files, err := changedFiles(repoDir, oldSha.Full(), gitSha.Full())
+			if err != nil {
+				// building anyway is only slower.
+				log.Info("unable to find the files changed since %s, building anyway (%s)", oldRev, err)
+			} else if _, changed := watchedChange(globs, files); !changed {
+				out.printf("Nothing in %s changed since %s, so skipping the build; push with -o %s to build anyway", strings.Join(globs, ", "), oldSha.Short(), pushOptionRebuild)
+				return nil
+			}
+		}
+	}
+
 	_, disableCaching := appConf.Values["DEIS_DISABLE_CACHE"]
-	slugBuilderInfo := NewSlugBuilderInfo(appName, gitSha.Short(), disableCaching)
+	tree, err := treeHash(repoDir, src.treeish(gitSha.Full()))
+	if err != nil {
+		if src.dir != "" {
+			return fmt.Errorf("finding the source directory %s in %s (%s)", src.dir, gitSha.Short(), err)
+		}
+		return err
+	}
+	slugBuilderInfo := NewSlugBuilderInfo(appName, gitSha.Short(), tree, disableCaching)
 
 	if slugBuilderInfo.DisableCaching() {
 		log.Debug("caching disabled for app %s", appName)
@@ -125,10 +169,14 @@ func build(
 	}
 
 	// build a tarball from the new objects
+	out.begin(phaseArchive)
+	if src.dir != "" {
+		out.printf("Building from %s", src.describe())
+	}
 	appTgz := fmt.Sprintf("%s.tar.gz", appName)
-	gitArchiveCmd := repoCmd(repoDir, "git", "archive", "--format=tar.gz", fmt.Sprintf("--output=%s", appTgz), gitSha.Short())
-	gitArchiveCmd.Stdout = os.Stdout
-	gitArchiveCmd.Stderr = os.Stderr
+	gitArchiveCmd := repoCmd(repoDir, "git", "archive", "--format=tar.gz", fmt.Sprintf("--output=%s", appTgz), src.treeish(gitSha.Short()))
+	gitArchiveCmd.Stdout = out
+	gitArchiveCmd.Stderr = out
 	if err := run(gitArchiveCmd); err != nil {
 		return fmt.Errorf("running %s (%s)", strings.Join(gitArchiveCmd.Args, " "), err)
 	}
@@ -136,24 +184,87 @@ func build(
 
 	// untar the archive into the temp dir
 	tarCmd := repoCmd(repoDir, "tar", "-xzf", appTgz, "-C", fmt.Sprintf("%s/", tmpDir))
-	tarCmd.Stdout = os.Stdout
-	tarCmd.Stderr = os.Stderr
+	tarCmd.Stdout = out
+	tarCmd.Stderr = out
 	if err := run(tarCmd); err != nil {
 		return fmt.Errorf("running %s (%s)", strings.Join(tarCmd.Args, " "), err)
 	}
 
-	bType := getBuildTypeForDir(tmpDir)
+	// the settings in the manifest are defaults, which the app config and push options override.
+	man, err := readManifest(tmpDir)
+	if err != nil {
+		return err
+	}
+	if man != nil {
+		var manProblems sourceProblems
+		validateManifest(&manProblems, man)
+		if err := manProblems.err(); err != nil {
+			return err
+		}
+		out.printf("Using the build settings in %s", manifestName)
+	}
+	man.dockerfile(&src, appConf.Values, pushOpts)
+	buildPackURL = man.buildpackURL(buildPackURL)
+
+	bType := getBuildTypeForDir(tmpDir, src.dockerfile)
+	forcedType, forced, err := man.buildType(appConf.Values)
+	if err != nil {
+		return err
+	}
+	if forced {
+		bType = forcedType
+	}
+	if bType == buildTypeCNB && conf.CNBBuilderImage == "" {
+		if forced {
+			return fmt.Errorf("the build type is %s, but this builder has no Cloud Native Buildpacks builder image", buildTypeCNB)
+		}
+		out.printf("Found project.toml, but Cloud Native Buildpacks builds aren't enabled, so building with buildpacks instead")
+		bType = buildTypeProcfile
+	}
 	usingDockerfile := bType == buildTypeDockerfile
 
+	problems, err := validateSource(tmpDir, src.dockerfile, bType, man)
+	if err != nil {
+		return err
+	}
+	for _, warning := range problems.warnings {
+		out.warnf("%s", warning)
+	}
+	if err := problems.err(); err != nil {
+		return err
+	}
+
 	appTgzdata, err := ioutil.ReadFile(absAppTgz)
 	if err != nil {
 		return fmt.Errorf("error while reading file %s: (%s)", appTgz, err)
 	}
 
+	out.begin(phaseUpload)
 	log.Debug("Uploading tar to %s", slugBuilderInfo.TarKey())
 
-	if err := storageDriver.PutContent(context.Background(), slugBuilderInfo.TarKey(), appTgzdata); err != nil {
-		return fmt.Errorf("uploading %s to %s (%v)", absAppTgz, slugBuilderInfo.TarKey(), err)
+	// the builder pod verifies the tarball against this checksum, which is also stored next to
+	// the tarball for anything else that downloads it.
+	tarSum, uploaded, err := uploadSource(storageDriver, slugBuilderInfo, appTgzdata)
+	if err != nil {
+		return fmt.Errorf("uploading %s (%v)", absAppTgz, err)
+	}
+	if !uploaded {
+		out.printf("Source of tree %s is already uploaded", tree[:8])
+	}
+
+	slugPushKey := slugBuilderInfo.PushKey()
+	reusedSlug := false
+	if _, reuse := appConf.Values[reuseSlugsKey]; reuse && !bType.buildsImage() {
+		if _, rebuild := pushOpts[pushOptionRebuild]; !rebuild {
+			pushKey, err := findBuiltSlug(storageDriver, slugBuilderInfo, buildPackURL)
+			if err != nil {
+				return err
+			}
+			if pushKey != "" {
+				slugPushKey, reusedSlug = pushKey, true
+				out.printf("Reusing the slug already built from tree %s; push with -o %s to build it again", tree[:8], pushOptionRebuild)
+			}
+		}
 	}
 
 	var pod *api.Pod
@@ -165,10 +276,22 @@ func build(
 		return fmt.Errorf("error build builder pod node selector %s", err)
 	}
 
-	if usingDockerfile {
-		buildPodName = dockerBuilderPodName(appName, gitSha.Short())
+	checks, err := parseBuildChecks(conf.BuildChecks)
+	if err != nil {
+		return fmt.Errorf("parsing BUILD_CHECKS (%s)", err)
+	}
+	var buildCheckImagePullPolicy api.PullPolicy
+	if len(checks) > 0 {
+		if buildCheckImagePullPolicy, err = k8s.PullPolicyFromString(conf.BuildCheckImagePullPolicy); err != nil {
+			return err
+		}
+	}
+
+	var registryEnv map[string]string
+	var cache *dockerCache
+	if bType.buildsImage() {
 		registryLocation := conf.RegistryLocation
-		registryEnv := make(map[string]string)
+		registryEnv = make(map[string]string)
 		if registryLocation != "on-cluster" {
 			registryEnv, err = getRegistryDetails(kubeClient, &image, registryLocation, conf.PodNamespace, conf.RegistrySecretPrefix)
 			if err != nil {
@@ -179,45 +302,98 @@ func build(
 		registryEnv["DEIS_REGISTRY_PROXY_PORT"] = conf.RegistryProxyPort
 		registryEnv["DEIS_REGISTRY_LOCATION"] = registryLocation
 
+		cache, err = newDockerCache(appName, conf.DockerBuildCacheMode, slugBuilderInfo.DisableCaching())
+		if err != nil {
+			return err
+		}
+		if cache == nil {
+			log.Debug("layer cache disabled for app %s", appName)
+		}
+	}
+
+	if usingDockerfile {
+		buildPodName = dockerBuilderPodName(appName, gitSha.Short())
+		builderImage, rootless, err := conf.DockerBuilder()
+		if err != nil {
+			return err
+		}
+		if rootless {
+			log.Debug("building app %s with the rootless builder %s", appName, builderImage)
+		}
+
 		pod = dockerBuilderPod(
 			conf.Debug,
 			buildPodName,
 			conf.PodNamespace,
 			appConf.Values,
+			man.dockerBuildArgs(appConf.Values),
 			slugBuilderInfo.TarKey(),
+			tarSum,
 			gitSha.Short(),
 			slugName,
+			cache,
 			conf.StorageType,
-			conf.DockerBuilderImage,
+			builderImage,
+			rootless,
 			conf.RegistryHost,
 			conf.RegistryPort,
 			registryEnv,
 			dockerBuilderImagePullPolicy,
 			builderPodNodeSelector,
 		)
-	} else {
+	} else if bType == buildTypeCNB {
+		cnbBuilderImagePullPolicy, err := k8s.PullPolicyFromString(conf.CNBBuilderImagePullPolicy)
+		if err != nil {
+			return err
+		}
+		buildPodName = cnbBuilderPodName(appName, gitSha.Short())
+		envSecretName, err := createBuildEnvSecret(kubeClient, conf.PodNamespace, appName, appConf.Values)
+		if err != nil {
+			return err
+		}
+		defer deleteBuildEnvSecret(kubeClient, conf.PodNamespace, envSecretName)
+		pod = cnbBuilderPod(
+			conf.Debug,
+			buildPodName,
+			conf.PodNamespace,
+			envSecretName,
+			slugBuilderInfo.TarKey(),
+			tarSum,
+			gitSha.Short(),
+			slugName,
+			cache,
+			man.buildpacks(),
+			conf.StorageType,
+			conf.CNBBuilderImage,
+			conf.RegistryHost,
+			conf.RegistryPort,
+			registryEnv,
+			cnbBuilderImagePullPolicy,
+			builderPodNodeSelector,
+		)
+	} else if !reusedSlug {
 		buildPodName = slugBuilderPodName(appName, gitSha.Short())
 
 		cacheKey := ""
 		if !slugBuilderInfo.DisableCaching() {
 			cacheKey = slugBuilderInfo.CacheKey()
+			if err := enforceCacheLimits(out, storageDriver, appName, slugBuilderInfo, conf.CacheLimits()); err != nil {
+				// the build can still use the cache, it's just bigger or older than it should be.
+				log.Info("unable to enforce the cache limits for app %s (%s)", appName, err)
+			}
 		}
-		envSecretName := fmt.Sprintf("%s-build-env", appName)
-		err = createAppEnvConfigSecret(kubeClient.Secrets(conf.PodNamespace), envSecretName, appConf.Values)
+		envSecretName, err := createBuildEnvSecret(kubeClient, conf.PodNamespace, appName, appConf.Values)
 		if err != nil {
-			return fmt.Errorf("error creating/updating secret %s: (%s)", envSecretName, err)
+			return err
 		}
-		defer func() {
-			if err := kubeClient.Secrets(conf.PodNamespace).Delete(envSecretName); err != nil {
-				log.Info("unable to delete secret %s (%s)", envSecretName, err)
-			}
-		}()
+		defer deleteBuildEnvSecret(kubeClient, conf.PodNamespace, envSecretName)
 		pod = slugbuilderPod(
 			conf.Debug,
 			buildPodName,
 			conf.PodNamespace,
 			envSecretName,
 			slugBuilderInfo.TarKey(),
+			tarSum,
 			slugBuilderInfo.PushKey(),
 			cacheKey,
 			gitSha.Short(),
@@ -229,8 +405,132 @@ func build(
 		)
 	}
 
-	log.Info("Starting build... but first, coffee!")
-	log.Debug("Starting pod %s", buildPodName)
+	if pod != nil {
+		addSourceToPod(pod, src, bType)
+		if resources := man.resources(); resources != nil {
+			pod.Spec.Containers[0].Resources.Requests = resources
+		}
+		if err := runBuilderPod(out, conf, kubeClient, pod); err != nil {
+			return err
+		}
+	}
+
+	procType, err := getProcFile(storageDriver, tmpDir, procfileKey(slugPushKey), bType)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stat(filepath.Join(tmpDir, "Procfile"))
+	procType = man.processTypes(procType, err == nil)
+
+	if !bType.buildsImage() {
+		if err := verifySlug(out, storageDriver, slugKey(slugPushKey), conf.RequireSlugChecksum); err != nil {
+			return err
+		}
+		if !reusedSlug {
+			if err := recordBuiltSlug(storageDriver, slugBuilderInfo, buildPackURL); err != nil {
+				log.Info("unable to record the slug built from tree %s (%s)", tree, err)
+			}
+		}
+	}
+
+	if len(checks) > 0 {
+		out.begin(phaseCheck)
+		checkImage := image
+		if conf.RegistryLocation == "on-cluster" {
+			checkImage = fmt.Sprintf("%s:%s/%s", conf.RegistryHost, conf.RegistryPort, slugName)
+		}
+		newPod := func(check buildCheck) *api.Pod {
+			name := buildCheckPodName(appName, check.name, gitSha.Short())
+			return buildCheckPod(conf.Debug, name, conf.PodNamespace, check, appName, gitSha.Short(), bType, checkImage, slugKey(slugPushKey), conf.StorageType, registryEnv, buildCheckImagePullPolicy, builderPodNodeSelector)
+		}
+		runCheck := func(pod *api.Pod) error {
+			return runBuildCheckPod(out, conf, kubeClient, pod)
+		}
+		if err := runBuildChecks(out, checks, newPod, runCheck); err != nil {
+			return err
+		}
+	}
+
+	if command := releaseCommand(procType); command != "" {
+		releasePod, err := newReleasePod(conf, appName, gitSha.Short(), appConf.Values, command, image, slugName, slugKey(slugPushKey), bType, builderPodNodeSelector)
+		if err != nil {
+			return err
+		}
+		if err := runReleasePod(out, conf, kubeClient, releasePod); err != nil {
+			return err
+		}
+	}
+
+	out.begin(phaseRelease)
+	if !bType.buildsImage() {
+		image = slugKey(slugPushKey)
+	}
+	stop := out.keepalive(conf.SessionIdleInterval())
+	release, err := hooks.CreateBuild(client, conf.Username, conf.App(), image, gitSha.Short(), procType, bType.buildsImage())
+	stop()
+	if controller.CheckAPICompat(client, err) != nil {
+		return fmt.Errorf("The controller returned an error when publishing the release: %s", err)
+	}
+	out.end()
+
+	out.printf("Done, %s:v%d deployed to Workflow", appName, release)
+	out.printf("Use 'deis open' to view this application in your browser")
+	out.printf("To learn more, use 'deis help' or visit https://deis.com/")
+
+	run(repoCmd(repoDir, "git", "gc"))
+
+	return nil
+}
+
+// createBuildEnvSecret stores the app config values env in a secret for a builder pod to mount,
+// and returns its name.
+func createBuildEnvSecret(kubeClient *client.Client, namespace, appName string, env map[string]interface{}) (string, error) {
+	envSecretName := fmt.Sprintf("%s-build-env", appName)
+	if err := createAppEnvConfigSecret(kubeClient.Secrets(namespace), envSecretName, env); err != nil {
+		return "", fmt.Errorf("error creating/updating secret %s: (%s)", envSecretName, err)
+	}
+	return envSecretName, nil
+}
+
+func deleteBuildEnvSecret(kubeClient *client.Client, namespace, envSecretName string) {
+	if err := kubeClient.Secrets(namespace).Delete(envSecretName); err != nil {
+		log.Info("unable to delete secret %s (%s)", envSecretName, err)
+	}
+}
+
+// runBuilderPod runs the builder pod to completion, streaming its logs to out. It returns an error
+// if the pod couldn't run or the build failed.
+func runBuilderPod(out *progressWriter, conf *Config, kubeClient *client.Client, pod *api.Pod) error {
+	out.begin(phaseSchedule)
+	out.printf("Starting build... but first, coffee!")
+	err := runPod(out, conf, kubeClient, pod, phaseBuild)
+	if exitErr, ok := err.(podExitError); ok {
+		if !exitErr.terminated {
+			return fmt.Errorf("Build pod container %s did not terminate, stopping build.", exitErr.container)
+		}
+		return fmt.Errorf("Build pod exited with code %d, stopping build.", exitErr.code)
+	}
+	return err
+}
+
+// podExitError is the error of a pod whose container didn't end successfully.
+type podExitError struct {
+	container  string
+	terminated bool
+	code       int
+}
+
+func (e podExitError) Error() string {
+	if !e.terminated {
+		return fmt.Sprintf("container %s did not terminate", e.container)
+	}
+	return fmt.Sprintf("container %s exited with code %d", e.container, e.code)
+}
+
+// runPod runs pod to completion, beginning logsPhase, if it's set, once the pod started and
+// streaming its logs to out. It returns a podExitError if the pod ran, but didn't succeed.
+func runPod(out *progressWriter, conf *Config, kubeClient *client.Client, pod *api.Pod, logsPhase buildPhase) error {
+	log.Debug("Starting pod %s", pod.Name)
 	json, err := prettyPrintJSON(pod)
 	if err == nil {
 		log.Debug("Pod spec: %v", json)
@@ -238,91 +538,73 @@ func build(
 		log.Debug("Error creating json representation of pod spec: %v", err)
 	}
 
-	podsInterface := kubeClient.Pods(conf.PodNamespace)
+	podsInterface := kubeClient.Pods(pod.Namespace)
 
 	newPod, err := podsInterface.Create(pod)
 	if err != nil {
-		return fmt.Errorf("creating builder pod (%s)", err)
+		return fmt.Errorf("creating pod %s (%s)", pod.Name, err)
 	}
 
-	pw := k8s.NewPodWatcher(kubeClient, conf.PodNamespace)
+	pw := k8s.NewPodWatcher(kubeClient, newPod.Namespace, labels.Set{"heritage": newPod.Name}.AsSelector())
 	stopCh := make(chan struct{})
 	defer close(stopCh)
 	go pw.Controller.Run(stopCh)
+	events := newPodEventReporter(out)
+	go k8s.NewPodEventWatcher(kubeClient, newPod.Namespace, newPod.Name, events.report).Run(stopCh)
 
-	if err := waitForPod(pw, newPod.Namespace, newPod.Name, conf.SessionIdleInterval(), conf.BuilderPodTickDuration(), conf.BuilderPodWaitDuration()); err != nil {
-		return fmt.Errorf("watching events for builder pod startup (%s)", err)
+	if err := waitForPod(out, pw, newPod.Namespace, newPod.Name, conf.SessionIdleInterval(), conf.BuilderPodWaitDuration()); err != nil {
+		return fmt.Errorf("watching events for pod %s startup (%s)", newPod.Name, err)
 	}
 
-	req := kubeClient.Get().Namespace(newPod.Namespace).Name(newPod.Name).Resource("pods").SubResource("log").VersionedParams(
-		&api.PodLogOptions{
-			Follow: true,
-		}, api.ParameterCodec)
-
-	rc, err := req.Stream()
-	if err != nil {
-		return fmt.Errorf("attempting to stream logs (%s)", err)
+	if logsPhase != "" {
+		out.begin(logsPhase)
 	}
-	defer rc.Close()
-
-	size, err := io.Copy(os.Stdout, rc)
-	if err != nil {
-		return fmt.Errorf("fetching builder logs (%s)", err)
+	logs := &logFollower{
+		out: out,
+		open: func(opts *api.PodLogOptions) (io.ReadCloser, error) {
+			return kubeClient.Get().Namespace(newPod.Namespace).Name(newPod.Name).Resource("pods").SubResource("log").VersionedParams(
+				opts, api.ParameterCodec).Stream()
+		},
+		finished: containerTerminated(pw, newPod.Name),
+		retry:    conf.BuilderPodTickDuration(),
+		timeout:  conf.BuilderPodWaitDuration(),
 	}
-	log.Debug("size of streamed logs %v", size)
+	if err := logs.run(); err != nil {
+		return fmt.Errorf("fetching the logs of pod %s (%s)", newPod.Name, err)
+	}
+	log.Debug("size of streamed logs %v", logs.written)
 
 	log.Debug(
-		"Waiting for the %s/%s pod to end. Checking every %s for %s",
+		"Waiting up to %s for the %s/%s pod to end",
+		conf.BuilderPodWaitDuration(),
 		newPod.Namespace,
 		newPod.Name,
-		conf.BuilderPodTickDuration(),
-		conf.BuilderPodWaitDuration(),
 	)
-	// check the state and exit code of the build pod.
+	// check the state and exit code of the pod.
 	// if the code is not 0 return error
-	if err := waitForPodEnd(pw, newPod.Namespace, newPod.Name, conf.BuilderPodTickDuration(), conf.BuilderPodWaitDuration()); err != nil {
-		return fmt.Errorf("error getting builder pod status (%s)", err)
+	if err := waitForPodEnd(pw, newPod.Namespace, newPod.Name, conf.BuilderPodWaitDuration()); err != nil {
+		return fmt.Errorf("error getting pod %s status (%s)", newPod.Name, err)
 	}
 	log.Debug("Done")
-	log.Debug("Checking for builder pod exit code")
-	buildPod, err := kubeClient.Pods(newPod.Namespace).Get(newPod.Name)
+	log.Debug("Checking for pod %s exit code", newPod.Name)
+	endedPod, err := kubeClient.Pods(newPod.Namespace).Get(newPod.Name)
 	if err != nil {
-		return fmt.Errorf("error getting builder pod status (%s)", err)
+		return fmt.Errorf("error getting pod %s status (%s)", newPod.Name, err)
 	}
 
-	for _, containerStatus := range buildPod.Status.ContainerStatuses {
+	if err := podFailure(endedPod); err != nil {
+		return err
+	}
+	for _, containerStatus := range endedPod.Status.ContainerStatuses {
 		state := containerStatus.State.Terminated
+		if state == nil {
+			return podExitError{container: containerStatus.Name}
+		}
 		if state.ExitCode != 0 {
-			return fmt.Errorf("Build pod exited with code %d, stopping build.", state.ExitCode)
+			return podExitError{container: containerStatus.Name, terminated: true, code: state.ExitCode}
 		}
 	}
 	log.Debug("Done")
-
-	procType, err := getProcFile(storageDriver, tmpDir, slugBuilderInfo.AbsoluteProcfileKey(), bType)
-	if err != nil {
-		return err
-	}
-
-	log.Info("Build complete.")
-
-	quit := progress("...", conf.SessionIdleInterval())
-	log.Info("Launching App...")
-	if !usingDockerfile {
-		image = slugBuilderInfo.AbsoluteSlugObjectKey()
-	}
-	release, err := hooks.CreateBuild(client, conf.Username, conf.App(), image, gitSha.Short(), procType, usingDockerfile)
-	quit <- true
-	<-quit
-	if controller.CheckAPICompat(client, err) != nil {
-		return fmt.Errorf("The controller returned an error when publishing the release: %s", err)
-	}
-
-	log.Info("Done, %s:v%d deployed to Workflow\n", appName, release)
-	log.Info("Use 'deis open' to view this application in your browser\n")
-	log.Info("To learn more, use 'deis help' or visit https://deis.com/\n")
-
-	run(repoCmd(repoDir, "git", "gc"))
-
 	return nil
 }
 
@@ -61,31 +61,31 @@ func TestBuild(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err := build(config, storageDriver, nil, fs, env, "foo", sha); err == nil {
+	if err := build(config, storageDriver, nil, fs, env, "foo", "", sha); err == nil {
 		t.Error("expected running build() without setting config.DockerBuilderImagePullPolicy to fail")
 	}
 
 	config.DockerBuilderImagePullPolicy = "Always"
-	if err := build(config, storageDriver, nil, fs, env, "foo", sha); err == nil {
+	if err := build(config, storageDriver, nil, fs, env, "foo", "", sha); err == nil {
 		t.Error("expected running build() without setting config.SlugBuilderImagePullPolicy to fail")
 	}
 
 	config.SlugBuilderImagePullPolicy = "Always"
 
-	err = build(config, storageDriver, nil, fs, env, "foo", "abc123")
+	err = build(config, storageDriver, nil, fs, env, "foo", "", "abc123")
 	expected := "git sha abc123 was invalid"
 	if err.Error() != expected {
 		t.Errorf("expected '%s', got '%v'", expected, err.Error())
 	}
 
-	if err := build(config, storageDriver, nil, fs, env, "foo", sha); err == nil {
+	if err := build(config, storageDriver, nil, fs, env, "foo", "", sha); err == nil {
 		t.Error("expected running build() without valid controller client info to fail")
 	}
 
 	config.ControllerHost = "localhost"
 	config.ControllerPort = "1234"
 
-	if err := build(config, storageDriver, nil, fs, env, "foo", sha); err == nil {
+	if err := build(config, storageDriver, nil, fs, env, "foo", "", sha); err == nil {
 		t.Error("expected running build() without a valid builder key to fail")
 	}
 
@@ -95,7 +95,7 @@ func TestBuild(t *testing.T) {
 		t.Fatalf("error creating %s (%s)", builderconf.BuilderKeyLocation, err)
 	}
 
-	if err := build(config, storageDriver, nil, fs, env, "foo", sha); err == nil {
+	if err := build(config, storageDriver, nil, fs, env, "foo", "", sha); err == nil {
 		t.Error("expected running build() without a valid controller connection to fail")
 	}
 }
@@ -3,23 +3,55 @@ package gitreceive
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 )
 
+// buildTypeKey is the app config key that forces a build type, whatever files the app has.
+const buildTypeKey = "DEIS_BUILD_TYPE"
+
 type buildType string
 
 func (b buildType) String() string {
 	return string(b)
 }
 
+// buildsImage returns true if builds of type b push an image to the registry, rather than a slug
+// to object storage.
+func (b buildType) buildsImage() bool {
+	return b == buildTypeDockerfile || b == buildTypeCNB
+}
+
 const (
 	buildTypeProcfile   buildType = "procfile"
 	buildTypeDockerfile buildType = "dockerfile"
+	// buildTypeCNB builds an image with Cloud Native Buildpacks.
+	buildTypeCNB buildType = "cnb"
 )
 
-func getBuildTypeForDir(dirName string) buildType {
-	_, err := os.Stat(fmt.Sprintf("%s/Dockerfile", dirName))
+// getBuildTypeForDir returns the type of the build of the source in dirName, whose Dockerfile, if
+// any, is at the path dockerfile relative to it.
+func getBuildTypeForDir(dirName, dockerfile string) buildType {
+	_, err := os.Stat(filepath.Join(dirName, filepath.FromSlash(dockerfile)))
 	if err == nil {
 		return buildTypeDockerfile
 	}
+	if _, err := os.Stat(fmt.Sprintf("%s/project.toml", dirName)); err == nil {
+		return buildTypeCNB
+	}
 	return buildTypeProcfile
 }
+
+// getForcedBuildType returns the build type that the app config values force, and false if they
+// don't force one.
+func getForcedBuildType(values map[string]interface{}) (buildType, bool, error) {
+	val, ok := values[buildTypeKey]
+	if !ok {
+		return "", false, nil
+	}
+	switch bType := buildType(fmt.Sprintf("%v", val)); bType {
+	case buildTypeProcfile, buildTypeDockerfile, buildTypeCNB:
+		return bType, true, nil
+	default:
+		return "", false, fmt.Errorf("invalid %s %q, must be %s, %s or %s", buildTypeKey, bType, buildTypeProcfile, buildTypeDockerfile, buildTypeCNB)
+	}
+}
@@ -1,13 +1,14 @@
 package gitreceive
 
 import (
+	"io/ioutil"
 	"os"
 	"testing"
 )
 
 func TestGetBuildTypeForDir(t *testing.T) {
 	tmpDir := os.TempDir()
-	bType := getBuildTypeForDir(tmpDir)
+	bType := getBuildTypeForDir(tmpDir, "Dockerfile")
 	if bType != buildTypeProcfile {
 		t.Fatalf("expected procfile build, got %s", bType)
 	}
@@ -20,8 +21,64 @@ func TestGetBuildTypeForDir(t *testing.T) {
 		}
 	}()
 
-	bType = getBuildTypeForDir(tmpDir)
+	bType = getBuildTypeForDir(tmpDir, "Dockerfile")
 	if bType != buildTypeDockerfile {
 		t.Fatalf("expected dockerfile build, got %s", bType)
 	}
 }
+
+func TestGetBuildTypeForDirProjectToml(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "tmpdir")
+	if err != nil {
+		t.Fatalf("error creating temp directory (%s)", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := ioutil.WriteFile(tmpDir+"/project.toml", []byte("[project]\n"), 0644); err != nil {
+		t.Fatalf("error creating %s/project.toml (%s)", tmpDir, err)
+	}
+	if bType := getBuildTypeForDir(tmpDir, "Dockerfile"); bType != buildTypeCNB {
+		t.Errorf("expected cnb build, got %s", bType)
+	}
+
+	if err := ioutil.WriteFile(tmpDir+"/Dockerfile", []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatalf("error creating %s/Dockerfile (%s)", tmpDir, err)
+	}
+	if bType := getBuildTypeForDir(tmpDir, "Dockerfile"); bType != buildTypeDockerfile {
+		t.Errorf("expected a Dockerfile to take precedence over project.toml, got %s build", bType)
+	}
+}
+
+func TestGetForcedBuildType(t *testing.T) {
+	if _, forced, err := getForcedBuildType(map[string]interface{}{}); forced || err != nil {
+		t.Errorf("expected no forced build type, got forced %v (%v)", forced, err)
+	}
+	bType, forced, err := getForcedBuildType(map[string]interface{}{"DEIS_BUILD_TYPE": "cnb"})
+	if err != nil || !forced || bType != buildTypeCNB {
+		t.Errorf("expected a forced cnb build, got %s build, forced %v (%v)", bType, forced, err)
+	}
+	if _, _, err := getForcedBuildType(map[string]interface{}{"DEIS_BUILD_TYPE": "heroku"}); err == nil {
+		t.Errorf("expected an error for an invalid build type")
+	}
+}
+
+func TestGetBuildTypeForDirDockerfilePath(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "tmpdir")
+	if err != nil {
+		t.Fatalf("error creating temp directory (%s)", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := os.MkdirAll(tmpDir+"/docker", 0755); err != nil {
+		t.Fatalf("error creating %s/docker (%s)", tmpDir, err)
+	}
+	if err := ioutil.WriteFile(tmpDir+"/docker/Dockerfile.prod", []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatalf("error creating %s/docker/Dockerfile.prod (%s)", tmpDir, err)
+	}
+	if bType := getBuildTypeForDir(tmpDir, "Dockerfile"); bType != buildTypeProcfile {
+		t.Errorf("expected procfile build without a Dockerfile at the root, got %s", bType)
+	}
+	if bType := getBuildTypeForDir(tmpDir, "docker/Dockerfile.prod"); bType != buildTypeDockerfile {
+		t.Errorf("expected dockerfile build, got %s", bType)
+	}
+}
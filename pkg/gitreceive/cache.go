@@ -0,0 +1,115 @@
+package gitreceive
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+// CacheStats describes the buildpack cache of an app.
+type CacheStats struct {
+	App string `json:"app"`
+	Key string `json:"key"`
+	// Size is the size of the cache in bytes.
+	Size int64 `json:"size"`
+	// LastUsed is the last time a build wrote the cache.
+	LastUsed time.Time `json:"lastUsed"`
+}
+
+// CacheLimits bounds the buildpack caches of apps. A zero field sets no limit.
+type CacheLimits struct {
+	// MaxSize is the largest a cache may grow, in bytes.
+	MaxSize int64
+	// MaxAge is the time after which a cache that no build wrote expires.
+	MaxAge time.Duration
+}
+
+// exceeded returns why stats are beyond l at now, or "" if they're within l.
+func (l CacheLimits) exceeded(stats CacheStats, now time.Time) string {
+	if l.MaxSize > 0 && stats.Size > l.MaxSize {
+		return fmt.Sprintf("it's %s, more than the %s limit", formatBytes(stats.Size), formatBytes(l.MaxSize))
+	}
+	if l.MaxAge > 0 && now.Sub(stats.LastUsed) > l.MaxAge {
+		return fmt.Sprintf("it wasn't used for %s", now.Sub(stats.LastUsed)/time.Hour*time.Hour)
+	}
+	return ""
+}
+
+// GetCacheStats returns the stats of the buildpack cache of app, and false if app has no cache.
+// A cache is usually a single object, but the size and last write of every object under key count
+// if it's a directory.
+func GetCacheStats(storageDriver storagedriver.StorageDriver, app string) (CacheStats, bool, error) {
+	stats := CacheStats{App: app, Key: fmt.Sprintf(CacheKeyPattern, app)}
+	if err := addCacheStats(storageDriver, stats.Key, &stats); err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return stats, false, nil
+		}
+		return stats, false, err
+	}
+	return stats, true, nil
+}
+
+func addCacheStats(storageDriver storagedriver.StorageDriver, key string, stats *CacheStats) error {
+	info, err := storageDriver.Stat(context.Background(), key)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		stats.Size += info.Size()
+		if info.ModTime().After(stats.LastUsed) {
+			stats.LastUsed = info.ModTime()
+		}
+		return nil
+	}
+	children, err := storageDriver.List(context.Background(), key)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := addCacheStats(storageDriver, child, stats); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enforceCacheLimits deletes the buildpack cache in info if it's beyond limits, so that the build
+// starts cold and writes a new one. It reports what it did to out.
+func enforceCacheLimits(out *progressWriter, storageDriver storagedriver.StorageDriver, app string, info *SlugBuilderInfo, limits CacheLimits) error {
+	if limits.MaxSize <= 0 && limits.MaxAge <= 0 {
+		return nil
+	}
+	stats, ok, err := GetCacheStats(storageDriver, app)
+	if err != nil {
+		return fmt.Errorf("getting the stats of cache %s (%s)", info.CacheKey(), err)
+	}
+	if !ok {
+		return nil
+	}
+	reason := limits.exceeded(stats, time.Now())
+	if reason == "" {
+		out.printf("Using the buildpack cache (%s, last used %s)", formatBytes(stats.Size), stats.LastUsed.Format(time.RFC3339))
+		return nil
+	}
+	out.printf("Discarding the buildpack cache, since %s. This build starts without it.", reason)
+	if err := storageDriver.Delete(context.Background(), info.CacheKey()); err != nil {
+		return fmt.Errorf("deleting cache %s (%s)", info.CacheKey(), err)
+	}
+	return nil
+}
+
+// formatBytes returns n bytes in the largest binary unit that's at most n.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
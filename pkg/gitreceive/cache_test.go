@@ -0,0 +1,104 @@
+package gitreceive
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arschles/assert"
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/factory"
+)
+
+// rootedDriver lets a driver that requires absolute paths take the relative keys the builder
+// uses, by rooting them at /.
+type rootedDriver struct {
+	storagedriver.StorageDriver
+}
+
+func root(path string) string {
+	return "/" + strings.TrimPrefix(path, "/")
+}
+
+func (d rootedDriver) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	return d.StorageDriver.Stat(ctx, root(path))
+}
+
+func (d rootedDriver) List(ctx context.Context, path string) ([]string, error) {
+	return d.StorageDriver.List(ctx, root(path))
+}
+
+func (d rootedDriver) PutContent(ctx context.Context, path string, content []byte) error {
+	return d.StorageDriver.PutContent(ctx, root(path), content)
+}
+
+func (d rootedDriver) Delete(ctx context.Context, path string) error {
+	return d.StorageDriver.Delete(ctx, root(path))
+}
+
+func newCacheDriver(t *testing.T) storagedriver.StorageDriver {
+	driver, err := factory.Create("inmemory", nil)
+	assert.NoErr(t, err)
+	return rootedDriver{driver}
+}
+
+func TestGetCacheStats(t *testing.T) {
+	driver := newCacheDriver(t)
+	_, ok, err := GetCacheStats(driver, "myapp")
+	assert.NoErr(t, err)
+	assert.False(t, ok, "found a cache that doesn't exist")
+
+	assert.NoErr(t, driver.PutContent(context.Background(), "home/myapp/cache", make([]byte, 100)))
+	stats, ok, err := GetCacheStats(driver, "myapp")
+	assert.NoErr(t, err)
+	assert.True(t, ok, "expected a cache")
+	assert.Equal(t, stats.Key, "home/myapp/cache", "key")
+	assert.Equal(t, stats.Size, int64(100), "size")
+	assert.True(t, time.Since(stats.LastUsed) < time.Minute, "unexpected last use %s", stats.LastUsed)
+
+	// a cache made of several objects counts them all.
+	assert.NoErr(t, driver.PutContent(context.Background(), "home/otherapp/cache/a", make([]byte, 100)))
+	assert.NoErr(t, driver.PutContent(context.Background(), "home/otherapp/cache/b/c", make([]byte, 50)))
+	stats, ok, err = GetCacheStats(driver, "otherapp")
+	assert.NoErr(t, err)
+	assert.True(t, ok, "expected a cache")
+	assert.Equal(t, stats.Size, int64(150), "size")
+}
+
+func TestCacheLimitsExceeded(t *testing.T) {
+	now := time.Now()
+	stats := CacheStats{Size: 2048, LastUsed: now.Add(-48 * time.Hour)}
+	assert.Equal(t, CacheLimits{}.exceeded(stats, now), "", "reason without limits")
+	assert.Equal(t, CacheLimits{MaxSize: 4096, MaxAge: 72 * time.Hour}.exceeded(stats, now), "", "reason within limits")
+	assert.Equal(t, CacheLimits{MaxSize: 1024}.exceeded(stats, now), "it's 2.0 KiB, more than the 1.0 KiB limit", "reason")
+	assert.Equal(t, CacheLimits{MaxAge: 24 * time.Hour}.exceeded(stats, now), "it wasn't used for 48h0m0s", "reason")
+}
+
+func TestEnforceCacheLimits(t *testing.T) {
+	driver := newCacheDriver(t)
+	info := NewSlugBuilderInfo("myapp", "c3b4e4ba", "4b825dc642cb6eb9a060e54bf8d69288fbee4904", false)
+	assert.NoErr(t, driver.PutContent(context.Background(), info.CacheKey(), make([]byte, 2048)))
+
+	var buf bytes.Buffer
+	out := newProgressWriter(&buf, false)
+	assert.NoErr(t, enforceCacheLimits(out, driver, "myapp", info, CacheLimits{MaxSize: 4096}))
+	assert.True(t, strings.Contains(buf.String(), "Using the buildpack cache (2.0 KiB"), "unexpected output %q", buf.String())
+	_, ok, err := GetCacheStats(driver, "myapp")
+	assert.NoErr(t, err)
+	assert.True(t, ok, "expected the cache to be kept")
+
+	buf.Reset()
+	assert.NoErr(t, enforceCacheLimits(out, driver, "myapp", info, CacheLimits{MaxSize: 1024}))
+	assert.True(t, strings.Contains(buf.String(), "Discarding the buildpack cache"), "unexpected output %q", buf.String())
+	_, ok, err = GetCacheStats(driver, "myapp")
+	assert.NoErr(t, err)
+	assert.False(t, ok, "expected the cache to be deleted")
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, formatBytes(512), "512 B", "bytes")
+	assert.Equal(t, formatBytes(1536), "1.5 KiB", "kibibytes")
+	assert.Equal(t, formatBytes(3*1024*1024*1024), "3.0 GiB", "gibibytes")
+}
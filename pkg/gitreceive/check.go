@@ -0,0 +1,155 @@
+package gitreceive
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/deis/pkg/log"
+	"github.com/pborman/uuid"
+	"k8s.io/kubernetes/pkg/api"
+	client "k8s.io/kubernetes/pkg/client/unversioned"
+)
+
+const (
+	// checkPolicyBlock fails the push when its check fails, so that the build isn't released.
+	checkPolicyBlock checkPolicy = "block"
+	// checkPolicyWarn only warns the client when its check fails.
+	checkPolicyWarn checkPolicy = "warn"
+
+	buildCheckName = "deis-buildcheck"
+)
+
+// checkName matches the names that build checks may have, which are part of pod names.
+var checkName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// checkPolicy is what a failed build check does to the push.
+type checkPolicy string
+
+// buildCheck is a check, such as a vulnerability scan, that a pod running image makes on every
+// build before it's released. The check fails if the pod exits with a non-zero code.
+type buildCheck struct {
+	name   string
+	image  string
+	policy checkPolicy
+}
+
+// parseBuildChecks parses the build checks in config, a comma separated list of name=image or
+// name:policy=image entries, run in that order. The policy defaults to checkPolicyBlock.
+func parseBuildChecks(config string) ([]buildCheck, error) {
+	var checks []buildCheck
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(config, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("invalid build check %q, must be name=image or name:policy=image", entry)
+		}
+		check := buildCheck{name: strings.TrimSpace(parts[0]), image: strings.TrimSpace(parts[1]), policy: checkPolicyBlock}
+		if i := strings.Index(check.name, ":"); i != -1 {
+			check.policy = checkPolicy(strings.TrimSpace(check.name[i+1:]))
+			check.name = strings.TrimSpace(check.name[:i])
+		}
+		if !checkName.MatchString(check.name) || len(check.name) > 20 {
+			return nil, fmt.Errorf("invalid build check name %q, must be up to 20 lowercase letters, digits and dashes", check.name)
+		}
+		if check.policy != checkPolicyBlock && check.policy != checkPolicyWarn {
+			return nil, fmt.Errorf("invalid policy %q of build check %s, must be %s or %s", check.policy, check.name, checkPolicyBlock, checkPolicyWarn)
+		}
+		if seen[check.name] {
+			return nil, fmt.Errorf("build check %s is defined more than once", check.name)
+		}
+		seen[check.name] = true
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+func buildCheckPodName(appName, checkName, shortSha string) string {
+	uid := uuid.New()[:8]
+	// pod names cannot exceed 63 characters in length, so we truncate the application name to stay
+	// under that limit when adding all the extra metadata to the name
+	if len(appName) > 18 {
+		appName = appName[:18]
+	}
+	return fmt.Sprintf("check-%s-%s-%s-%s", checkName, appName, shortSha, uid)
+}
+
+// buildCheckPod returns a pod that runs check on the build of the app appName from the commit
+// shortSha. Image builds are checked in the image imageName, which registryEnv has the
+// credentials of, and slug builds in the slug at slugKey.
+func buildCheckPod(
+	debug bool,
+	name,
+	namespace string,
+	check buildCheck,
+	appName,
+	shortSha string,
+	bType buildType,
+	imageName,
+	slugKey,
+	storageType string,
+	registryEnv map[string]string,
+	pullPolicy api.PullPolicy,
+	nodeSelector map[string]string,
+) *api.Pod {
+
+	pod := buildPod(debug, name, namespace, pullPolicy, nodeSelector, nil)
+
+	pod.Spec.Containers[0].Name = buildCheckName
+	pod.Spec.Containers[0].Image = check.image
+
+	addEnvToPod(pod, "DEIS_APP", appName)
+	addEnvToPod(pod, sourceVersion, shortSha)
+	addEnvToPod(pod, buildTypeKey, bType.String())
+	addEnvToPod(pod, "DEIS_CHECK_POLICY", string(check.policy))
+	if bType.buildsImage() {
+		addEnvToPod(pod, "IMG_NAME", imageName)
+		for key, value := range registryEnv {
+			addEnvToPod(pod, key, value)
+		}
+	} else {
+		addEnvToPod(pod, slugURL, slugKey)
+		addEnvToPod(pod, builderStorage, storageType)
+	}
+
+	return &pod
+}
+
+// runBuildChecks runs checks in order with run, on the pods that newPod returns for them. Failed
+// checks with checkPolicyWarn are reported to out as warnings, and it returns an error listing
+// the failed checks with checkPolicyBlock, after running all of them. A check whose pod couldn't
+// run failed.
+func runBuildChecks(out *progressWriter, checks []buildCheck, newPod func(buildCheck) *api.Pod, run func(*api.Pod) error) error {
+	var blocking []string
+	for _, check := range checks {
+		out.printf("Running check %s (%s)", check.name, check.policy)
+		err := run(newPod(check))
+		if err == nil {
+			out.printf("Check %s passed", check.name)
+			continue
+		}
+		if check.policy == checkPolicyWarn {
+			out.warnf("check %s failed (%s)", check.name, err)
+			continue
+		}
+		blocking = append(blocking, fmt.Sprintf("%s (%s)", check.name, err))
+	}
+	if len(blocking) > 0 {
+		return fmt.Errorf("%d build check(s) failed, stopping the release:\n%s", len(blocking), strings.Join(blocking, "\n"))
+	}
+	return nil
+}
+
+// runBuildCheckPod runs the check pod to completion, streaming its logs to out, and deletes it.
+func runBuildCheckPod(out *progressWriter, conf *Config, kubeClient *client.Client, pod *api.Pod) error {
+	defer func() {
+		if err := kubeClient.Pods(pod.Namespace).Delete(pod.Name, nil); err != nil {
+			log.Info("unable to delete build check pod %s (%s)", pod.Name, err)
+		}
+	}()
+	return runPod(out, conf, kubeClient, pod, "")
+}
@@ -0,0 +1,116 @@
+package gitreceive
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/arschles/assert"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestParseBuildChecks(t *testing.T) {
+	checks, err := parseBuildChecks("")
+	assert.NoErr(t, err)
+	assert.Equal(t, len(checks), 0, "number of checks")
+
+	checks, err = parseBuildChecks("trivy=aquasec/trivy:0.50, licenses:warn = example.com/license-check@sha256:abc,policy:block=opa")
+	assert.NoErr(t, err)
+	assert.Equal(t, len(checks), 3, "number of checks")
+	assert.Equal(t, checks[0], buildCheck{name: "trivy", image: "aquasec/trivy:0.50", policy: checkPolicyBlock}, "first check")
+	assert.Equal(t, checks[1], buildCheck{name: "licenses", image: "example.com/license-check@sha256:abc", policy: checkPolicyWarn}, "second check")
+	assert.Equal(t, checks[2], buildCheck{name: "policy", image: "opa", policy: checkPolicyBlock}, "third check")
+
+	for _, config := range []string{
+		"trivy",
+		"trivy=",
+		"Trivy=aquasec/trivy",
+		"trivy:maybe=aquasec/trivy",
+		"this-name-is-way-too-long=aquasec/trivy",
+		"trivy=aquasec/trivy,trivy:warn=aquasec/trivy",
+	} {
+		if _, err := parseBuildChecks(config); err == nil {
+			t.Errorf("expected an error for build checks %q", config)
+		}
+	}
+}
+
+func TestBuildCheckPodName(t *testing.T) {
+	name := buildCheckPodName("this-name-has-more-than-24-characters-in-length", "a-twenty-char-check1", "12345678")
+	if !strings.HasPrefix(name, "check-a-twenty-char-check1-this-name-has-more-12345678-") {
+		t.Errorf("expected pod name check-a-twenty-char-check1-this-name-has-more-12345678-*, got %s", name)
+	}
+	if len(name) > 63 {
+		t.Errorf("expected build check pod name length to be <= 63 characters in length, got %d", len(name))
+	}
+}
+
+func TestBuildCheckPod(t *testing.T) {
+	check := buildCheck{name: "trivy", image: "aquasec/trivy", policy: checkPolicyWarn}
+	regEnv := map[string]string{"DEIS_REGISTRY_LOCATION": "on-cluster"}
+	pod := buildCheckPod(false, "test", "deis", check, "myapp", "deadbeef", buildTypeDockerfile, "registry:5000/myapp:git-deadbeef", "", "minio", regEnv, api.PullAlways, nil)
+	assert.Equal(t, pod.Spec.Containers[0].Image, "aquasec/trivy", "image")
+	assert.Equal(t, pod.Spec.Containers[0].ImagePullPolicy, api.PullAlways, "pull policy")
+	checkForEnv(t, pod, "DEIS_APP", "myapp")
+	checkForEnv(t, pod, "SOURCE_VERSION", "deadbeef")
+	checkForEnv(t, pod, "DEIS_BUILD_TYPE", "dockerfile")
+	checkForEnv(t, pod, "DEIS_CHECK_POLICY", "warn")
+	checkForEnv(t, pod, "IMG_NAME", "registry:5000/myapp:git-deadbeef")
+	checkForEnv(t, pod, "DEIS_REGISTRY_LOCATION", "on-cluster")
+
+	pod = buildCheckPod(false, "test", "deis", check, "myapp", "deadbeef", buildTypeProcfile, "", "home/myapp:git-deadbeef/push/slug.tgz", "minio", nil, api.PullIfNotPresent, nil)
+	checkForEnv(t, pod, "SLUG_URL", "home/myapp:git-deadbeef/push/slug.tgz")
+	checkForEnv(t, pod, "BUILDER_STORAGE", "minio")
+	if _, err := envValueFromKey(pod, "IMG_NAME"); err == nil {
+		t.Errorf("expected no IMG_NAME for a slug build")
+	}
+}
+
+func TestRunBuildChecks(t *testing.T) {
+	checks := []buildCheck{
+		{name: "trivy", image: "aquasec/trivy", policy: checkPolicyBlock},
+		{name: "licenses", image: "license-check", policy: checkPolicyWarn},
+		{name: "policy", image: "opa", policy: checkPolicyBlock},
+	}
+	newPod := func(check buildCheck) *api.Pod {
+		return &api.Pod{ObjectMeta: api.ObjectMeta{Name: check.name}}
+	}
+
+	var ran []string
+	var buf bytes.Buffer
+	run := func(pod *api.Pod) error {
+		ran = append(ran, pod.Name)
+		return nil
+	}
+	assert.NoErr(t, runBuildChecks(newProgressWriter(&buf, false), checks, newPod, run))
+	assert.Equal(t, strings.Join(ran, ","), "trivy,licenses,policy", "checks run")
+
+	// a failed warning check only warns.
+	buf.Reset()
+	run = func(pod *api.Pod) error {
+		if pod.Name == "licenses" {
+			return errors.New("GPL-3.0 found")
+		}
+		return nil
+	}
+	assert.NoErr(t, runBuildChecks(newProgressWriter(&buf, false), checks, newPod, run))
+	if !strings.Contains(buf.String(), "warning: check licenses failed (GPL-3.0 found)") {
+		t.Errorf("expected a warning about the licenses check, got %q", buf.String())
+	}
+
+	// failed blocking checks fail the release, after every check ran.
+	ran = nil
+	run = func(pod *api.Pod) error {
+		ran = append(ran, pod.Name)
+		if pod.Name == "trivy" {
+			return errors.New("CVE-2016-0001 found")
+		}
+		return nil
+	}
+	err := runBuildChecks(newProgressWriter(&buf, false), checks, newPod, run)
+	if err == nil || !strings.Contains(err.Error(), "trivy (CVE-2016-0001 found)") {
+		t.Errorf("expected an error about the trivy check, got %v", err)
+	}
+	assert.Equal(t, strings.Join(ran, ","), "trivy,licenses,policy", "checks run")
+}
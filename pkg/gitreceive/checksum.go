@@ -0,0 +1,93 @@
+package gitreceive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/deis/builder/pkg/storage"
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+const (
+	// checksumSuffix is appended to an object's key to get the key of its SHA-256 checksum, which
+	// is stored as a hex string.
+	checksumSuffix = ".sha256"
+	tarChecksum    = "TAR_SHA256"
+)
+
+// checksumKey returns the key of the checksum of the object at key.
+func checksumKey(key string) string {
+	return key + checksumSuffix
+}
+
+// sha256Hex returns the hex encoded SHA-256 checksum of data.
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// objectReader is a *(github.com/docker/distribution/registry/storage/driver).StorageDriver
+// compatible interface, restricted to what's needed to verify an object against its checksum.
+type objectReader interface {
+	storage.ObjectGetter
+	Reader(ctx context.Context, path string, offset int64) (io.ReadCloser, error)
+}
+
+// errNoChecksum is returned by verifyChecksum when there's no checksum to verify against.
+type errNoChecksum struct {
+	key string
+}
+
+func (e errNoChecksum) Error() string {
+	return fmt.Sprintf("no checksum found for %s", e.key)
+}
+
+// verifyChecksum checks the object at key against the checksum stored next to it. The object is
+// streamed rather than loaded into memory, since slugs can be large.
+func verifyChecksum(reader objectReader, key string) error {
+	ctx := context.Background()
+	expected, err := reader.GetContent(ctx, checksumKey(key))
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return errNoChecksum{key: key}
+		}
+		return fmt.Errorf("getting the checksum of %s (%s)", key, err)
+	}
+
+	rc, err := reader.Reader(ctx, key, 0)
+	if err != nil {
+		return fmt.Errorf("reading %s (%s)", key, err)
+	}
+	defer rc.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, rc); err != nil {
+		return fmt.Errorf("reading %s (%s)", key, err)
+	}
+
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if want := strings.ToLower(strings.TrimSpace(string(expected))); actual != want {
+		return fmt.Errorf("%s is corrupt: its SHA-256 checksum is %s, expected %s", key, actual, want)
+	}
+	return nil
+}
+
+// verifySlug checks the slug at key against its checksum before it's released. The slug builder
+// writes the checksum next to the slug, at key plus checksumSuffix; slug builders that don't
+// leave slugs unverified, which is an error if required is true, and otherwise a warning.
+func verifySlug(out *progressWriter, reader objectReader, key string, required bool) error {
+	err := verifyChecksum(reader, key)
+	if _, ok := err.(errNoChecksum); ok {
+		if required {
+			return fmt.Errorf("the slug builder didn't write a checksum for the slug, which REQUIRE_SLUG_CHECKSUM requires")
+		}
+		out.warnf("the slug builder didn't write a checksum for the slug, so it couldn't be verified")
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("verifying the slug (%s)", err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package gitreceive
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/arschles/assert"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestSHA256Hex(t *testing.T) {
+	// echo -n "hello world" | sha256sum
+	assert.Equal(t, sha256Hex([]byte("hello world")), "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", "checksum")
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	driver := inmemory.New()
+	ctx := context.Background()
+	slug := []byte("slug contents")
+	assert.NoErr(t, driver.PutContent(ctx, "/push/slug.tgz", slug))
+
+	err := verifyChecksum(driver, "/push/slug.tgz")
+	if _, ok := err.(errNoChecksum); !ok {
+		t.Errorf("expected errNoChecksum, got %v", err)
+	}
+
+	// the slug builder may write the checksum with a trailing newline, as sha256sum does.
+	assert.NoErr(t, driver.PutContent(ctx, "/push/slug.tgz.sha256", []byte(sha256Hex(slug)+"\n")))
+	assert.NoErr(t, verifyChecksum(driver, "/push/slug.tgz"))
+
+	assert.NoErr(t, driver.PutContent(ctx, "/push/slug.tgz", []byte("truncated")))
+	err = verifyChecksum(driver, "/push/slug.tgz")
+	if err == nil || !strings.Contains(err.Error(), "/push/slug.tgz is corrupt") {
+		t.Errorf("expected a corrupt slug error, got %v", err)
+	}
+}
+
+func TestVerifySlug(t *testing.T) {
+	driver := inmemory.New()
+	ctx := context.Background()
+	slug := []byte("slug contents")
+	assert.NoErr(t, driver.PutContent(ctx, "/push/slug.tgz", slug))
+
+	var buf bytes.Buffer
+	assert.NoErr(t, verifySlug(newProgressWriter(&buf, false), driver, "/push/slug.tgz", false))
+	assert.Equal(t, buf.String(), "       warning: the slug builder didn't write a checksum for the slug, so it couldn't be verified\n", "output")
+
+	err := verifySlug(newProgressWriter(&buf, false), driver, "/push/slug.tgz", true)
+	if err == nil || !strings.Contains(err.Error(), "REQUIRE_SLUG_CHECKSUM") {
+		t.Errorf("expected an error about the missing checksum, got %v", err)
+	}
+
+	assert.NoErr(t, driver.PutContent(ctx, "/push/slug.tgz.sha256", []byte("0000")))
+	err = verifySlug(newProgressWriter(&buf, false), driver, "/push/slug.tgz", false)
+	if err == nil || !strings.Contains(err.Error(), "verifying the slug") {
+		t.Errorf("expected a corrupt slug error, got %v", err)
+	}
+}
@@ -1,13 +1,19 @@
 package gitreceive
 
 import (
+	"fmt"
 	"strings"
 	"time"
+
+	"github.com/deis/builder/pkg/storage"
 )
 
 const (
 	builderPodTick    = 100
 	objectStorageTick = 500
+
+	dockerBuilderModeDocker   = "docker"
+	dockerBuilderModeRootless = "rootless"
 )
 
 // Config is the envconfig (http://github.com/kelseyhightower/envconfig) compatible struct for the
@@ -40,8 +46,21 @@ type Config struct {
 	DockerBuilderImage            string `envconfig:"DOCKERBUILDER_IMAGE_NAME" required:"true"`
 	SlugBuilderImagePullPolicy    string `envconfig:"SLUG_BUILDER_IMAGE_PULL_POLICY" default:"Always"`
 	DockerBuilderImagePullPolicy  string `envconfig:"DOCKER_BUILDER_IMAGE_PULL_POLICY" default:"Always"`
+	DockerBuilderMode             string `envconfig:"DOCKER_BUILDER_MODE" default:"docker"` // "docker" or "rootless"
+	RootlessBuilderImage          string `envconfig:"ROOTLESS_BUILDER_IMAGE_NAME" default:""`
+	CNBBuilderImage               string `envconfig:"CNB_BUILDER_IMAGE_NAME" default:""`
+	CNBBuilderImagePullPolicy     string `envconfig:"CNB_BUILDER_IMAGE_PULL_POLICY" default:"Always"`
+	SlugRunnerImage               string `envconfig:"SLUGRUNNER_IMAGE_NAME" default:""`
+	SlugRunnerImagePullPolicy     string `envconfig:"SLUG_RUNNER_IMAGE_PULL_POLICY" default:"Always"`
 	StorageType                   string `envconfig:"BUILDER_STORAGE" default:"minio"`
 	BuilderPodNodeSelector        string `envconfig:"BUILDER_POD_NODE_SELECTOR" default:""`
+	OutputColor                   string `envconfig:"BUILDER_OUTPUT_COLOR" default:"never"` // "always" or "never"
+	BuildpackCacheMaxSizeMB       int    `envconfig:"BUILDPACK_CACHE_MAX_SIZE_MB" default:"0"`
+	BuildpackCacheMaxAgeDays      int    `envconfig:"BUILDPACK_CACHE_MAX_AGE_DAYS" default:"0"`
+	DockerBuildCacheMode          string `envconfig:"DOCKER_BUILD_CACHE_MODE" default:"max"` // "max", "min" or "off"
+	BuildChecks                   string `envconfig:"BUILD_CHECKS" default:""`               // "name=image,name:warn=image"
+	BuildCheckImagePullPolicy     string `envconfig:"BUILD_CHECK_IMAGE_PULL_POLICY" default:"Always"`
+	RequireSlugChecksum           bool   `envconfig:"REQUIRE_SLUG_CHECKSUM" default:"false"`
 }
 
 // App returns the application name represented by c. The app name is the same as c.Repository
@@ -54,8 +73,8 @@ func (c Config) App() string {
 	return c.Repository[0:li]
 }
 
-// BuilderPodTickDuration returns the size of the interval used to check for
-// the end of the execution of a Pod building an application.
+// BuilderPodTickDuration returns the initial interval between attempts to reconnect
+// to the logs of a Pod building an application.
 func (c Config) BuilderPodTickDuration() time.Duration {
 	return time.Duration(time.Duration(c.BuilderPodTickDurationMSec) * time.Millisecond)
 }
@@ -66,18 +85,49 @@ func (c Config) BuilderPodWaitDuration() time.Duration {
 	return time.Duration(time.Duration(c.BuilderPodWaitDurationMSec) * time.Millisecond)
 }
 
-// ObjectStorageTickDuration returns the size of the interval used to check for
-// the end of an operation that involves the object storage.
+// ObjectStorageTickDuration returns the time to wait before retrying a failed
+// operation that involves the object storage. Later retries wait exponentially longer.
 func (c Config) ObjectStorageTickDuration() time.Duration {
 	return time.Duration(time.Duration(c.ObjectStorageTickDurationMSec) * time.Millisecond)
 }
 
-// ObjectStorageWaitDuration returns the maximum time to wait for the end of an
-// operation that involves the object storage.
+// ObjectStorageWaitDuration returns the maximum time to spend on an
+// operation that involves the object storage, retries included.
 func (c Config) ObjectStorageWaitDuration() time.Duration {
 	return time.Duration(time.Duration(c.ObjectStorageWaitDurationMSec) * time.Millisecond)
 }
 
+// ObjectStorageBackoff returns the policy for retrying failed object storage operations.
+func (c Config) ObjectStorageBackoff() storage.Backoff {
+	backoff := storage.DefaultBackoff()
+	backoff.Initial = c.ObjectStorageTickDuration()
+	backoff.Deadline = c.ObjectStorageWaitDuration()
+	return backoff
+}
+
+// CacheLimits returns the limits of the buildpack caches of apps.
+func (c Config) CacheLimits() CacheLimits {
+	return CacheLimits{
+		MaxSize: int64(c.BuildpackCacheMaxSizeMB) * 1024 * 1024,
+		MaxAge:  time.Duration(c.BuildpackCacheMaxAgeDays) * 24 * time.Hour,
+	}
+}
+
+// DockerBuilder returns the image that builds Dockerfile apps, and true if it's a rootless
+// builder, which builds without a Docker daemon and so doesn't get the node's Docker socket.
+func (c Config) DockerBuilder() (string, bool, error) {
+	switch c.DockerBuilderMode {
+	case dockerBuilderModeDocker:
+		return c.DockerBuilderImage, false, nil
+	case dockerBuilderModeRootless:
+		if c.RootlessBuilderImage == "" {
+			return "", false, fmt.Errorf("ROOTLESS_BUILDER_IMAGE_NAME is required for %s Dockerfile builds", dockerBuilderModeRootless)
+		}
+		return c.RootlessBuilderImage, true, nil
+	}
+	return "", false, fmt.Errorf("invalid Dockerfile builder mode %q, must be %s or %s", c.DockerBuilderMode, dockerBuilderModeDocker, dockerBuilderModeRootless)
+}
+
 // SessionIdleInterval returns the ticker interval to wait for status
 func (c Config) SessionIdleInterval() time.Duration {
 	return time.Duration(time.Duration(c.SessionIdleIntervalMsec) * time.Millisecond)
@@ -44,3 +44,27 @@ func TestCheckDurations(t *testing.T) {
 		}
 	}
 }
+
+func TestDockerBuilder(t *testing.T) {
+	cnf := Config{DockerBuilderMode: "docker", DockerBuilderImage: "dockerbuilder", RootlessBuilderImage: "rootless"}
+	image, rootless, err := cnf.DockerBuilder()
+	if err != nil || image != "dockerbuilder" || rootless {
+		t.Errorf("expected dockerbuilder, got %s (rootless %v, error %v)", image, rootless, err)
+	}
+
+	cnf.DockerBuilderMode = "rootless"
+	image, rootless, err = cnf.DockerBuilder()
+	if err != nil || image != "rootless" || !rootless {
+		t.Errorf("expected the rootless builder, got %s (rootless %v, error %v)", image, rootless, err)
+	}
+
+	cnf.RootlessBuilderImage = ""
+	if _, _, err := cnf.DockerBuilder(); err == nil {
+		t.Errorf("expected an error for the rootless mode without an image")
+	}
+
+	cnf.DockerBuilderMode = "kaniko"
+	if _, _, err := cnf.DockerBuilder(); err == nil {
+		t.Errorf("expected an error for an invalid mode")
+	}
+}
@@ -0,0 +1,117 @@
+package gitreceive
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/deis/builder/pkg/storage"
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+// reuseSlugsKey is the app config key that, when set, lets a push reuse the slug already built
+// from the same git tree instead of building it again.
+const reuseSlugsKey = "DEIS_REUSE_SLUGS"
+
+// treeHash returns the hash of the git tree that rev points to in the repository at repoDir.
+// Commits with the same tree have the same contents, whatever their history. rev may also name a
+// directory in a commit, as <commit>:<path>.
+func treeHash(repoDir, rev string) (string, error) {
+	spec := rev + "^{tree}"
+	if strings.Contains(rev, ":") {
+		// git would take the suffix as part of the path.
+		spec = rev
+	}
+	cmd := repoCmd(repoDir, "git", "rev-parse", "--verify", "-q", spec)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("running %s (%s)", strings.Join(cmd.Args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// uploadSource uploads the tarball data to info.TarKey(), and its checksum next to it, unless a
+// tarball for the same tree is already there. It returns the checksum of the tarball in storage,
+// and whether it uploaded it.
+//
+// The checksum is written after the tarball, so a tarball is only reused if its upload finished.
+// A reused tarball keeps the time it was uploaded at, so the tree's used marker is refreshed
+// instead, which keeps the cleaner from deleting the tree while this push builds from it.
+func uploadSource(driver storagedriver.StorageDriver, info *SlugBuilderInfo, data []byte) (string, bool, error) {
+	ctx := context.Background()
+	sum, err := driver.GetContent(ctx, info.TarChecksumKey())
+	if err == nil {
+		if exists, err := storage.ObjectExists(driver, info.TarKey()); err == nil && exists {
+			if err := markUsed(driver, info.TreeUsedKey()); err != nil {
+				return "", false, err
+			}
+			return strings.TrimSpace(string(sum)), false, nil
+		}
+	} else if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+		return "", false, fmt.Errorf("checking for %s (%s)", info.TarChecksumKey(), err)
+	}
+
+	if err := driver.PutContent(ctx, info.TarKey(), data); err != nil {
+		return "", false, fmt.Errorf("uploading to %s (%s)", info.TarKey(), err)
+	}
+	newSum := sha256Hex(data)
+	if err := driver.PutContent(ctx, info.TarChecksumKey(), []byte(newSum)); err != nil {
+		return "", false, fmt.Errorf("uploading checksum to %s (%s)", info.TarChecksumKey(), err)
+	}
+	return newSum, true, nil
+}
+
+// markUsed writes the time now to the used marker at key.
+func markUsed(driver storagedriver.StorageDriver, key string) error {
+	if err := driver.PutContent(context.Background(), key, []byte(time.Now().UTC().Format(time.RFC3339))); err != nil {
+		return fmt.Errorf("marking %s as used (%s)", path.Dir(key), err)
+	}
+	return nil
+}
+
+// builtSlug records which slug was built from a git tree, and how.
+type builtSlug struct {
+	PushKey      string `json:"pushKey"`
+	BuildpackURL string `json:"buildpackURL"`
+}
+
+// findBuiltSlug returns the push key of the slug built from the tree in info with buildpackURL,
+// or "" if there's no such slug. The used marker of the build holding the slug is refreshed, so
+// that the cleaner doesn't date the slug by its original build while it's being reused.
+func findBuiltSlug(driver storagedriver.StorageDriver, info *SlugBuilderInfo, buildpackURL string) (string, error) {
+	data, err := driver.GetContent(context.Background(), info.BuiltSlugKey())
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return "", nil
+		}
+		return "", fmt.Errorf("getting %s (%s)", info.BuiltSlugKey(), err)
+	}
+	var slug builtSlug
+	if err := json.Unmarshal(data, &slug); err != nil {
+		return "", fmt.Errorf("%s is malformed (%s)", info.BuiltSlugKey(), err)
+	}
+	if slug.BuildpackURL != buildpackURL {
+		return "", nil
+	}
+	exists, err := storage.ObjectExists(driver, slugKey(slug.PushKey))
+	if err != nil || !exists {
+		return "", err
+	}
+	if err := markUsed(driver, usedKey(path.Dir(slug.PushKey))); err != nil {
+		return "", err
+	}
+	return slug.PushKey, nil
+}
+
+// recordBuiltSlug records that the slug at info.PushKey() was built from the tree in info with
+// buildpackURL.
+func recordBuiltSlug(driver storagedriver.StorageDriver, info *SlugBuilderInfo, buildpackURL string) error {
+	data, err := json.Marshal(builtSlug{PushKey: info.PushKey(), BuildpackURL: buildpackURL})
+	if err != nil {
+		return err
+	}
+	return driver.PutContent(context.Background(), info.BuiltSlugKey(), data)
+}
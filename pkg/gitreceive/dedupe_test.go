@@ -0,0 +1,115 @@
+package gitreceive
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/arschles/assert"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/storage/driver/factory"
+)
+
+// testSlugBuilderInfo returns a SlugBuilderInfo with keys the inmemory driver accepts.
+func testSlugBuilderInfo(sha string) *SlugBuilderInfo {
+	return &SlugBuilderInfo{
+		pushKey:      "/home/myapp/git-" + sha + "/push",
+		tarKey:       "/home/myapp/tree-4b825dc/tar",
+		builtSlugKey: "/home/myapp/tree-4b825dc/slug",
+		treeUsedKey:  "/home/myapp/tree-4b825dc/used",
+		cacheKey:     "/home/myapp/cache",
+	}
+}
+
+func TestTreeHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tree-hash")
+	assert.NoErr(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "first"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "second"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("running git %v (%s): %s", args, err, out)
+		}
+	}
+
+	first, err := treeHash(dir, "HEAD~1")
+	assert.NoErr(t, err)
+	second, err := treeHash(dir, "HEAD")
+	assert.NoErr(t, err)
+	// both commits are empty, so they share the empty tree.
+	assert.Equal(t, first, "4b825dc642cb6eb9a060e54bf8d69288fbee4904", "tree hash")
+	assert.Equal(t, second, first, "tree hash")
+
+	if _, err := treeHash(dir, "nosuchrev"); err == nil {
+		t.Errorf("expected an error for a revision that doesn't exist")
+	}
+}
+
+func TestUploadSource(t *testing.T) {
+	driver, err := factory.Create("inmemory", nil)
+	assert.NoErr(t, err)
+	info := testSlugBuilderInfo("c3b4e4ba")
+	data := []byte("source tarball")
+
+	sum, uploaded, err := uploadSource(driver, info, data)
+	assert.NoErr(t, err)
+	assert.True(t, uploaded, "expected the first upload to happen")
+	assert.Equal(t, sum, sha256Hex(data), "checksum")
+	stored, err := driver.GetContent(context.Background(), info.TarChecksumKey())
+	assert.NoErr(t, err)
+	assert.Equal(t, string(stored), sum, "stored checksum")
+
+	sum, uploaded, err = uploadSource(driver, testSlugBuilderInfo("d0e1f2a3"), []byte("ignored"))
+	assert.NoErr(t, err)
+	assert.False(t, uploaded, "expected a tarball of the same tree not to be uploaded again")
+	assert.Equal(t, sum, sha256Hex(data), "checksum")
+	if _, err := driver.Stat(context.Background(), info.TreeUsedKey()); err != nil {
+		t.Errorf("expected a reused tree to be marked as used (%s)", err)
+	}
+
+	// a tarball whose upload didn't finish has no checksum, so it's uploaded again.
+	assert.NoErr(t, driver.Delete(context.Background(), info.TarChecksumKey()))
+	_, uploaded, err = uploadSource(driver, info, data)
+	assert.NoErr(t, err)
+	assert.True(t, uploaded, "expected a tarball without a checksum to be uploaded again")
+}
+
+func TestBuiltSlug(t *testing.T) {
+	driver, err := factory.Create("inmemory", nil)
+	assert.NoErr(t, err)
+	info := testSlugBuilderInfo("c3b4e4ba")
+	buildpack := "https://github.com/heroku/heroku-buildpack-go"
+
+	pushKey, err := findBuiltSlug(driver, info, buildpack)
+	assert.NoErr(t, err)
+	assert.Equal(t, pushKey, "", "push key before any build")
+
+	assert.NoErr(t, recordBuiltSlug(driver, info, buildpack))
+	pushKey, err = findBuiltSlug(driver, info, buildpack)
+	assert.NoErr(t, err)
+	assert.Equal(t, pushKey, "", "push key of a recorded slug that doesn't exist")
+
+	assert.NoErr(t, driver.PutContent(context.Background(), info.AbsoluteSlugObjectKey(), []byte("slug")))
+	pushKey, err = findBuiltSlug(driver, testSlugBuilderInfo("d0e1f2a3"), buildpack)
+	assert.NoErr(t, err)
+	assert.Equal(t, pushKey, info.PushKey(), "push key")
+	if _, err := driver.Stat(context.Background(), "/home/myapp/git-c3b4e4ba/used"); err != nil {
+		t.Errorf("expected the build of a reused slug to be marked as used (%s)", err)
+	}
+
+	pushKey, err = findBuiltSlug(driver, info, "https://github.com/heroku/heroku-buildpack-ruby")
+	assert.NoErr(t, err)
+	assert.Equal(t, pushKey, "", "push key of a slug built with another buildpack")
+
+	assert.NoErr(t, driver.PutContent(context.Background(), info.BuiltSlugKey(), []byte("{")))
+	if _, err := findBuiltSlug(driver, info, buildpack); err == nil {
+		t.Errorf("expected an error for a malformed record")
+	}
+}
@@ -0,0 +1,56 @@
+package gitreceive
+
+import (
+	"fmt"
+)
+
+const (
+	// dockerCacheTag is the tag of the image that holds the layer cache of an app's Dockerfile builds.
+	dockerCacheTag = "buildcache"
+
+	dockerCacheModeMax = "max"
+	dockerCacheModeMin = "min"
+	dockerCacheModeOff = "off"
+
+	cacheImgName    = "CACHE_IMG_NAME"
+	dockerCacheFrom = "DOCKER_CACHE_FROM"
+	dockerCacheTo   = "DOCKER_CACHE_TO"
+)
+
+// dockerCache is the registry-backed layer cache of the Dockerfile builds of an app. It lives in
+// the registry the dockerbuilder pushes the app's images to, so a build reuses the layers of the
+// last one whichever node it runs on.
+type dockerCache struct {
+	// ref is the image holding the cache, which the dockerbuilder resolves against the registry
+	// the same way it resolves IMG_NAME.
+	ref string
+	// mode is the BuildKit cache export mode: max exports the layers of every build stage, min
+	// only those of the final image.
+	mode string
+}
+
+// newDockerCache returns the layer cache of the Dockerfile builds of appName with the given mode,
+// or nil if mode is off or the app disabled caching.
+func newDockerCache(appName, mode string, disableCaching bool) (*dockerCache, error) {
+	switch mode {
+	case dockerCacheModeMax, dockerCacheModeMin:
+	case dockerCacheModeOff:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("invalid docker build cache mode %q, must be %s, %s or %s", mode, dockerCacheModeMax, dockerCacheModeMin, dockerCacheModeOff)
+	}
+	if disableCaching {
+		return nil, nil
+	}
+	return &dockerCache{ref: fmt.Sprintf("%s:%s", appName, dockerCacheTag), mode: mode}, nil
+}
+
+// cacheFrom returns the --cache-from setting that imports the cache into a build.
+func (c dockerCache) cacheFrom() string {
+	return fmt.Sprintf("type=registry,ref=%s", c.ref)
+}
+
+// cacheTo returns the --cache-to setting that exports the layers of a build to the cache.
+func (c dockerCache) cacheTo() string {
+	return fmt.Sprintf("type=registry,ref=%s,mode=%s", c.ref, c.mode)
+}
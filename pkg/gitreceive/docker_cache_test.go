@@ -0,0 +1,35 @@
+package gitreceive
+
+import (
+	"testing"
+
+	"github.com/arschles/assert"
+)
+
+func TestNewDockerCache(t *testing.T) {
+	cache, err := newDockerCache("myapp", dockerCacheModeMax, false)
+	assert.NoErr(t, err)
+	assert.NotNil(t, cache, "cache")
+	assert.Equal(t, cache.ref, "myapp:buildcache", "cache ref")
+	assert.Equal(t, cache.cacheFrom(), "type=registry,ref=myapp:buildcache", "cache-from")
+	assert.Equal(t, cache.cacheTo(), "type=registry,ref=myapp:buildcache,mode=max", "cache-to")
+
+	cache, err = newDockerCache("myapp", dockerCacheModeMin, false)
+	assert.NoErr(t, err)
+	assert.Equal(t, cache.cacheTo(), "type=registry,ref=myapp:buildcache,mode=min", "cache-to")
+
+	cache, err = newDockerCache("myapp", dockerCacheModeMax, true)
+	assert.NoErr(t, err)
+	if cache != nil {
+		t.Errorf("expected no cache for an app that disabled caching, got %+v", cache)
+	}
+
+	cache, err = newDockerCache("myapp", dockerCacheModeOff, false)
+	assert.NoErr(t, err)
+	if cache != nil {
+		t.Errorf("expected no cache with caching turned off, got %+v", cache)
+	}
+
+	_, err = newDockerCache("myapp", "all", false)
+	assert.ExistsErr(t, err, "invalid mode")
+}
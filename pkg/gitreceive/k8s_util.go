@@ -3,6 +3,7 @@ package gitreceive
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/deis/builder/pkg/k8s"
@@ -17,18 +18,27 @@ import (
 const (
 	slugBuilderName   = "deis-slugbuilder"
 	dockerBuilderName = "deis-dockerbuilder"
+	cnbBuilderName    = "deis-cnbbuilder"
 
 	tarPath          = "TAR_PATH"
 	putPath          = "PUT_PATH"
 	cachePath        = "CACHE_PATH"
 	debugKey         = "DEIS_DEBUG"
 	sourceVersion    = "SOURCE_VERSION"
+	sourceDirEnv     = "SOURCE_DIR"
+	dockerfileEnv    = "DOCKERFILE"
 	objectStore      = "objectstorage-keyfile"
 	dockerSocketName = "docker-socket"
 	dockerSocketPath = "/var/run/docker.sock"
 	builderStorage   = "BUILDER_STORAGE"
 	objectStorePath  = "/var/run/secrets/deis/objectstore/creds"
 	envRoot          = "/tmp/env"
+	// dockerBuildArgsKey is the app config key that passes the app config to Dockerfile builds
+	// as build args.
+	dockerBuildArgsKey = "DEIS_DOCKER_BUILD_ARGS_ENABLED"
+	// cnbPlatformEnv is where the Cloud Native Buildpacks lifecycle reads the build environment
+	// from, one file per variable.
+	cnbPlatformEnv = "/platform/env"
 )
 
 func dockerBuilderPodName(appName, shortSha string) string {
@@ -51,16 +61,30 @@ func slugBuilderPodName(appName, shortSha string) string {
 	return fmt.Sprintf("slugbuild-%s-%s-%s", appName, shortSha, uid)
 }
 
+func cnbBuilderPodName(appName, shortSha string) string {
+	uid := uuid.New()[:8]
+	// NOTE(bacongobbler): pod names cannot exceed 63 characters in length, so we truncate
+	// the application name to stay under that limit when adding all the extra metadata to the name
+	if len(appName) > 36 {
+		appName = appName[:36]
+	}
+	return fmt.Sprintf("cnbbuild-%s-%s-%s", appName, shortSha, uid)
+}
+
 func dockerBuilderPod(
 	debug bool,
 	name,
 	namespace string,
 	env map[string]interface{},
+	buildArgs map[string]interface{},
 	tarKey,
+	tarSum,
 	gitShortHash string,
-	imageName,
+	imageName string,
+	cache *dockerCache,
 	storageType,
-	image,
+	image string,
+	rootless bool,
 	registryHost,
 	registryPort string,
 	registryEnv map[string]string,
@@ -70,15 +94,15 @@ func dockerBuilderPod(
 
 	pod := buildPod(debug, name, namespace, pullPolicy, nodeSelector, env)
 
-	// inject application envvars as a special envvar which will be handled by dockerbuilder to
+	// inject the build args as a special envvar which will be handled by dockerbuilder to
 	// inject them as build-time variables.
 	// NOTE(bacongobbler): docker-py takes buildargs as a json string in the form of
 	//
 	// {"KEY": "value"}
 	//
 	// So we need to translate the map into json.
-	if _, ok := env["DEIS_DOCKER_BUILD_ARGS_ENABLED"]; ok {
-		dockerBuildArgs, _ := json.Marshal(env)
+	if len(buildArgs) > 0 {
+		dockerBuildArgs, _ := json.Marshal(buildArgs)
 		addEnvToPod(pod, "DOCKER_BUILD_ARGS", string(dockerBuildArgs))
 	}
 
@@ -86,6 +110,7 @@ func dockerBuilderPod(
 	pod.Spec.Containers[0].Image = image
 
 	addEnvToPod(pod, tarPath, tarKey)
+	addEnvToPod(pod, tarChecksum, tarSum)
 	addEnvToPod(pod, sourceVersion, gitShortHash)
 	addEnvToPod(pod, "IMG_NAME", imageName)
 	addEnvToPod(pod, builderStorage, storageType)
@@ -98,6 +123,18 @@ func dockerBuilderPod(
 		addEnvToPod(pod, key, value)
 	}
 
+	// without a cache, the build only reuses the layers it finds on the node it runs on.
+	if cache != nil {
+		addEnvToPod(pod, cacheImgName, cache.ref)
+		addEnvToPod(pod, dockerCacheFrom, cache.cacheFrom())
+		addEnvToPod(pod, dockerCacheTo, cache.cacheTo())
+	}
+
+	// a rootless builder builds without a daemon, so it doesn't get the socket of the node's.
+	if rootless {
+		return &pod
+	}
+
 	pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, api.VolumeMount{
 		Name:      dockerSocketName,
 		MountPath: dockerSocketPath,
@@ -121,6 +158,7 @@ func slugbuilderPod(
 	namespace string,
 	envSecretName string,
 	tarKey,
+	tarSum,
 	putKey,
 	cacheKey,
 	gitShortHash string,
@@ -157,6 +195,7 @@ func slugbuilderPod(
 	}
 
 	addEnvToPod(pod, tarPath, tarKey)
+	addEnvToPod(pod, tarChecksum, tarSum)
 	addEnvToPod(pod, putPath, putKey)
 	addEnvToPod(pod, sourceVersion, gitShortHash)
 	addEnvToPod(pod, builderStorage, storageType)
@@ -168,6 +207,74 @@ func slugbuilderPod(
 	return &pod
 }
 
+// cnbBuilderPod returns a pod that builds the app with the Cloud Native Buildpacks lifecycle of
+// image and pushes the resulting image to the registry as imageName. It gets the source like the
+// other builders do, and the app config as the lifecycle's platform environment.
+func cnbBuilderPod(
+	debug bool,
+	name,
+	namespace string,
+	envSecretName string,
+	tarKey,
+	tarSum,
+	gitShortHash string,
+	imageName string,
+	cache *dockerCache,
+	buildpacks []string,
+	storageType,
+	image,
+	registryHost,
+	registryPort string,
+	registryEnv map[string]string,
+	pullPolicy api.PullPolicy,
+	nodeSelector map[string]string,
+) *api.Pod {
+
+	pod := buildPod(debug, name, namespace, pullPolicy, nodeSelector, nil)
+
+	pod.Spec.Volumes = append(pod.Spec.Volumes, api.Volume{
+		Name: envSecretName,
+		VolumeSource: api.VolumeSource{
+			Secret: &api.SecretVolumeSource{
+				SecretName: envSecretName,
+			},
+		},
+	})
+
+	pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, api.VolumeMount{
+		Name:      envSecretName,
+		MountPath: cnbPlatformEnv,
+		ReadOnly:  true,
+	})
+
+	pod.Spec.Containers[0].Name = cnbBuilderName
+	pod.Spec.Containers[0].Image = image
+
+	addEnvToPod(pod, tarPath, tarKey)
+	addEnvToPod(pod, tarChecksum, tarSum)
+	addEnvToPod(pod, sourceVersion, gitShortHash)
+	addEnvToPod(pod, "IMG_NAME", imageName)
+	addEnvToPod(pod, builderStorage, storageType)
+	addEnvToPod(pod, "DEIS_REGISTRY_SERVICE_HOST", registryHost)
+	addEnvToPod(pod, "DEIS_REGISTRY_SERVICE_PORT", registryPort)
+
+	for key, value := range registryEnv {
+		addEnvToPod(pod, key, value)
+	}
+
+	// the lifecycle keeps its layer cache in an image of its own, so only the reference applies.
+	if cache != nil {
+		addEnvToPod(pod, cacheImgName, cache.ref)
+	}
+
+	// without buildpacks, the lifecycle detects which of the builder's buildpacks apply.
+	if len(buildpacks) > 0 {
+		addEnvToPod(pod, "CNB_BUILDPACKS", strings.Join(buildpacks, ","))
+	}
+
+	return &pod
+}
+
 func buildPod(
 	debug bool,
 	name,
@@ -232,6 +339,17 @@ func buildPod(
 	return pod
 }
 
+// addSourceToPod tells the builder in pod which directory of the repository its source tarball
+// holds, if not the root, and for Dockerfile builds, where the Dockerfile is in it.
+func addSourceToPod(pod *api.Pod, src buildSource, bType buildType) {
+	if src.dir != "" {
+		addEnvToPod(*pod, sourceDirEnv, src.dir)
+	}
+	if bType == buildTypeDockerfile {
+		addEnvToPod(*pod, dockerfileEnv, src.dockerfile)
+	}
+}
+
 func addEnvToPod(pod api.Pod, key, value string) {
 	if len(pod.Spec.Containers) > 0 {
 		pod.Spec.Containers[0].Env = append(pod.Spec.Containers[0].Env, api.EnvVar{
@@ -241,9 +359,14 @@ func addEnvToPod(pod api.Pod, key, value string) {
 	}
 }
 
-// waitForPod waits for a pod in state running, succeeded or failed
-func waitForPod(pw *k8s.PodWatcher, ns, podName string, ticker, interval, timeout time.Duration) error {
+// waitForPod waits for a pod in state running or succeeded, writing a keepalive line to out
+// every ticker. It gives up as soon as the pod fails or gets stuck in a state it can't recover
+// from, such as an image that can't be pulled.
+func waitForPod(out *progressWriter, pw *k8s.PodWatcher, ns, podName string, ticker, timeout time.Duration) error {
 	condition := func(pod *api.Pod) (bool, error) {
+		if err := podFailure(pod); err != nil {
+			return true, fmt.Errorf("Giving up; %s", err)
+		}
 		if pod.Status.Phase == api.PodRunning {
 			return true, nil
 		}
@@ -256,15 +379,13 @@ func waitForPod(pw *k8s.PodWatcher, ns, podName string, ticker, interval, timeou
 		return false, nil
 	}
 
-	quit := progress("...", ticker)
-	err := waitForPodCondition(pw, ns, podName, condition, interval, timeout)
-	quit <- true
-	<-quit
-	return err
+	stop := out.keepalive(ticker)
+	defer stop()
+	return waitForPodCondition(pw, ns, podName, condition, timeout)
 }
 
 // waitForPodEnd waits for a pod in state succeeded or failed
-func waitForPodEnd(pw *k8s.PodWatcher, ns, podName string, interval, timeout time.Duration) error {
+func waitForPodEnd(pw *k8s.PodWatcher, ns, podName string, timeout time.Duration) error {
 	condition := func(pod *api.Pod) (bool, error) {
 		if pod.Status.Phase == api.PodSucceeded {
 			return true, nil
@@ -275,45 +396,34 @@ func waitForPodEnd(pw *k8s.PodWatcher, ns, podName string, interval, timeout tim
 		return false, nil
 	}
 
-	return waitForPodCondition(pw, ns, podName, condition, interval, timeout)
+	return waitForPodCondition(pw, ns, podName, condition, timeout)
 }
 
-// waitForPodCondition waits for a pod in state defined by a condition (func)
+// waitForPodCondition waits for a pod in state defined by a condition (func). The condition is
+// checked once up front and then every time pw reports a change, rather than on a timer.
 func waitForPodCondition(pw *k8s.PodWatcher, ns, podName string, condition func(pod *api.Pod) (bool, error),
-	interval, timeout time.Duration) error {
-	return wait.PollImmediate(interval, timeout, func() (bool, error) {
-		pods, err := pw.Store.List(labels.Set{"heritage": podName}.AsSelector())
-		if err != nil || len(pods) == 0 {
-			return false, nil
-		}
-
-		done, err := condition(pods[0])
-		if err != nil {
-			return false, err
-		}
-		if done {
-			return true, nil
+	timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	selector := labels.Set{"heritage": podName}.AsSelector()
+	for {
+		pods, err := pw.Store.List(selector)
+		if err == nil && len(pods) > 0 {
+			done, err := condition(pods[0])
+			if err != nil {
+				return err
+			}
+			if done {
+				return nil
+			}
 		}
 
-		return false, nil
-	})
-}
-
-func progress(msg string, interval time.Duration) chan bool {
-	tick := time.Tick(interval)
-	quit := make(chan bool)
-	go func() {
-		for {
-			select {
-			case <-quit:
-				close(quit)
-				return
-			case <-tick:
-				fmt.Println(msg)
-			}
+		select {
+		case <-pw.Changed():
+		case <-timer.C:
+			return wait.ErrWaitTimeout
 		}
-	}()
-	return quit
+	}
 }
 
 func createAppEnvConfigSecret(secretsClient client.SecretsInterface, secretName string, env map[string]interface{}) error {
@@ -42,6 +42,43 @@ func TestSlugBuilderPodName(t *testing.T) {
 	}
 }
 
+func TestCNBBuilderPodName(t *testing.T) {
+	name := cnbBuilderPodName("this-name-has-more-than-24-characters-in-length", "12345678")
+	if !strings.HasPrefix(name, "cnbbuild-this-name-has-more-than-24-character-12345678-") {
+		t.Errorf("expected pod name cnbbuild-this-name-has-more-than-24-character-12345678-*, got %s", name)
+	}
+	if len(name) > 63 {
+		t.Errorf("expected cnbbuilder pod name length to be <= 63 characters in length, got %d", len(name))
+	}
+}
+
+func TestCNBBuilderPod(t *testing.T) {
+	cache := &dockerCache{ref: "myapp:buildcache", mode: "max"}
+	regEnv := map[string]string{"DEIS_REGISTRY_LOCATION": "on-cluster"}
+	pod := cnbBuilderPod(false, "test", "default", "test-build-env", "tar", "tarsum", "deadbeef", "myapp:git-deadbeef",
+		cache, []string{"https://example.com/bp1", "https://example.com/bp2"}, "minio", "cnbbuilder", "localhost", "5555", regEnv, api.PullAlways, nil)
+
+	assert.Equal(t, pod.Spec.Containers[0].Image, "cnbbuilder", "image")
+	checkForEnv(t, pod, "TAR_PATH", "tar")
+	checkForEnv(t, pod, "TAR_SHA256", "tarsum")
+	checkForEnv(t, pod, "IMG_NAME", "myapp:git-deadbeef")
+	checkForEnv(t, pod, "CACHE_IMG_NAME", "myapp:buildcache")
+	checkForEnv(t, pod, "CNB_BUILDPACKS", "https://example.com/bp1,https://example.com/bp2")
+	checkForEnv(t, pod, "DEIS_REGISTRY_LOCATION", "on-cluster")
+
+	mounted := false
+	for _, mount := range pod.Spec.Containers[0].VolumeMounts {
+		if mount.Name == "test-build-env" {
+			mounted = true
+			assert.Equal(t, mount.MountPath, "/platform/env", "env mount path")
+		}
+		if mount.MountPath == "/var/run/docker.sock" {
+			t.Errorf("expected the cnbbuilder not to mount the docker socket")
+		}
+	}
+	assert.True(t, mounted, "expected the env secret to be mounted")
+}
+
 type slugBuildCase struct {
 	debug                      bool
 	name                       string
@@ -70,6 +107,8 @@ type dockerBuildCase struct {
 	dockerBuilderImagePullPolicy api.PullPolicy
 	storageType                  string
 	builderPodNodeSelector       map[string]string
+	cache                        *dockerCache
+	rootless                     bool
 }
 
 func TestBuildPod(t *testing.T) {
@@ -110,6 +149,7 @@ func TestBuildPod(t *testing.T) {
 			build.namespace,
 			build.envSecretName,
 			build.tarKey,
+			"tarsum",
 			build.putKey,
 			build.cacheKey,
 			build.gitShortHash,
@@ -130,6 +170,7 @@ func TestBuildPod(t *testing.T) {
 
 		checkForEnv(t, pod, "SOURCE_VERSION", build.gitShortHash)
 		checkForEnv(t, pod, "TAR_PATH", build.tarKey)
+		checkForEnv(t, pod, "TAR_SHA256", "tarsum")
 		checkForEnv(t, pod, "PUT_PATH", build.putKey)
 
 		if build.cacheKey == "" {
@@ -161,14 +202,14 @@ func TestBuildPod(t *testing.T) {
 	}
 
 	dockerBuilds := []dockerBuildCase{
-		{true, "test", "default", emptyEnv, "tar", "deadbeef", "", "", api.PullAlways, "", nodeSelector1},
-		{true, "test", "default", env, "tar", "deadbeef", "", "", api.PullAlways, "", nodeSelector2},
-		{true, "test", "default", emptyEnv, "tar", "deadbeef", "img", "", api.PullAlways, "", emptyNodeSelector},
-		{true, "test", "default", env, "tar", "deadbeef", "img", "", api.PullAlways, "", emptyNodeSelector},
-		{true, "test", "default", env, "tar", "deadbeef", "img", "customimage", api.PullAlways, "", emptyNodeSelector},
-		{true, "test", "default", env, "tar", "deadbeef", "img", "customimage", api.PullIfNotPresent, "", emptyNodeSelector},
-		{true, "test", "default", env, "tar", "deadbeef", "img", "customimage", api.PullNever, "", nil},
-		{true, "test", "default", buildArgsEnv, "tar", "deadbeef", "img", "customimage", api.PullIfNotPresent, "", emptyNodeSelector},
+		{true, "test", "default", emptyEnv, "tar", "deadbeef", "", "", api.PullAlways, "", nodeSelector1, nil, false},
+		{true, "test", "default", env, "tar", "deadbeef", "", "", api.PullAlways, "", nodeSelector2, nil, false},
+		{true, "test", "default", emptyEnv, "tar", "deadbeef", "img", "", api.PullAlways, "", emptyNodeSelector, nil, false},
+		{true, "test", "default", env, "tar", "deadbeef", "img", "", api.PullAlways, "", emptyNodeSelector, &dockerCache{ref: "img:buildcache", mode: "max"}, false},
+		{true, "test", "default", env, "tar", "deadbeef", "img", "customimage", api.PullAlways, "", emptyNodeSelector, nil, true},
+		{true, "test", "default", env, "tar", "deadbeef", "img", "customimage", api.PullIfNotPresent, "", emptyNodeSelector, nil, false},
+		{true, "test", "default", env, "tar", "deadbeef", "img", "customimage", api.PullNever, "", nil, nil, false},
+		{true, "test", "default", buildArgsEnv, "tar", "deadbeef", "img", "customimage", api.PullIfNotPresent, "", emptyNodeSelector, nil, false},
 	}
 	regEnv := map[string]string{"REG_LOC": "on-cluster"}
 	for _, build := range dockerBuilds {
@@ -177,11 +218,15 @@ func TestBuildPod(t *testing.T) {
 			build.name,
 			build.namespace,
 			build.env,
+			(*manifest)(nil).dockerBuildArgs(build.env),
 			build.tarKey,
+			"tarsum",
 			build.gitShortHash,
 			build.imgName,
+			build.cache,
 			build.storageType,
 			build.dockerBuilderImage,
+			build.rootless,
 			"localhost",
 			"5555",
 			regEnv,
@@ -198,8 +243,18 @@ func TestBuildPod(t *testing.T) {
 
 		checkForEnv(t, pod, "SOURCE_VERSION", build.gitShortHash)
 		checkForEnv(t, pod, "TAR_PATH", build.tarKey)
+		checkForEnv(t, pod, "TAR_SHA256", "tarsum")
 		checkForEnv(t, pod, "IMG_NAME", build.imgName)
 		checkForEnv(t, pod, "REG_LOC", "on-cluster")
+		if build.cache == nil {
+			if ref, err := envValueFromKey(pod, "CACHE_IMG_NAME"); err == nil {
+				t.Errorf("expected CACHE_IMG_NAME not to be defined but it was defined with %v", ref)
+			}
+		} else {
+			checkForEnv(t, pod, "CACHE_IMG_NAME", build.cache.ref)
+			checkForEnv(t, pod, "DOCKER_CACHE_FROM", "type=registry,ref="+build.cache.ref)
+			checkForEnv(t, pod, "DOCKER_CACHE_TO", "type=registry,ref="+build.cache.ref+",mode=max")
+		}
 		if _, ok := build.env["DEIS_DOCKER_BUILD_ARGS_ENABLED"]; ok {
 			checkForEnv(t, pod, "DOCKER_BUILD_ARGS", `{"DEIS_DOCKER_BUILD_ARGS_ENABLED":"1","KEY":"VALUE"}`)
 		}
@@ -219,6 +274,21 @@ func TestBuildPod(t *testing.T) {
 		if len(pod.Spec.NodeSelector) > 0 || len(build.builderPodNodeSelector) > 0 {
 			assert.Equal(t, pod.Spec.NodeSelector, build.builderPodNodeSelector, "node selector")
 		}
+
+		mountsSocket := false
+		for _, mount := range pod.Spec.Containers[0].VolumeMounts {
+			if mount.MountPath == "/var/run/docker.sock" {
+				mountsSocket = true
+			}
+		}
+		if mountsSocket == build.rootless {
+			t.Errorf("expected the docker socket to be mounted %v, but it was mounted %v", !build.rootless, mountsSocket)
+		}
+		for _, volume := range pod.Spec.Volumes {
+			if build.rootless && volume.HostPath != nil {
+				t.Errorf("expected no host path volume for a rootless builder, got %s", volume.HostPath.Path)
+			}
+		}
 	}
 }
 
@@ -0,0 +1,246 @@
+package gitreceive
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	deisAPI "github.com/deis/controller-sdk-go/api"
+	"gopkg.in/yaml.v2"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/resource"
+)
+
+// manifestName is the name of the manifest file, at the root of the source.
+const manifestName = "deis.yaml"
+
+var (
+	// envVarName matches the names that build args may have.
+	envVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	manifestKeys      = []string{"build", "processes"}
+	manifestBuildKeys = []string{"type", "buildpacks", "dockerfile", "args", "resources"}
+)
+
+// manifest is an app's deis.yaml, which declares how the app is built in its repository. Every
+// setting in it is a default: the app config, and then push options, take precedence over it.
+type manifest struct {
+	Build     manifestBuild     `yaml:"build"`
+	Processes map[string]string `yaml:"processes"`
+}
+
+// manifestBuild is the build section of a manifest.
+type manifestBuild struct {
+	// Type is the build type, as DEIS_BUILD_TYPE sets it.
+	Type string `yaml:"type"`
+	// Buildpacks are the URLs of the buildpacks to build with. Slug builds take a single one, as
+	// BUILDPACK_URL sets it.
+	Buildpacks []string `yaml:"buildpacks"`
+	// Dockerfile is the path of the Dockerfile, as DEIS_DOCKERFILE sets it.
+	Dockerfile string `yaml:"dockerfile"`
+	// Args are the build args of Dockerfile builds.
+	Args map[string]string `yaml:"args"`
+	// Resources are the CPU and memory that the builder pod requests.
+	Resources map[string]string `yaml:"resources"`
+}
+
+// readManifest reads the manifest of the source extracted to dir, and returns nil if it has none.
+// Errors are about the syntax of the manifest; validateManifest checks its contents.
+func readManifest(dir string) (*manifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, manifestName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading %s (%s)", manifestName, err)
+	}
+
+	raw := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s is malformed (%s)", manifestName, err)
+	}
+	if err := checkKeys(raw, "", manifestKeys); err != nil {
+		return nil, err
+	}
+	if build, ok := raw["build"].(map[interface{}]interface{}); ok {
+		rawBuild := map[string]interface{}{}
+		for key, val := range build {
+			rawBuild[fmt.Sprintf("%v", key)] = val
+		}
+		if err := checkKeys(rawBuild, "build.", manifestBuildKeys); err != nil {
+			return nil, err
+		}
+	}
+
+	m := &manifest{}
+	if err := yaml.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("%s is malformed (%s)", manifestName, err)
+	}
+	return m, nil
+}
+
+// checkKeys returns an error naming the first key of raw, in order, that isn't one of known.
+// Unknown keys are usually misspelled known ones, which would be ignored otherwise.
+func checkKeys(raw map[string]interface{}, prefix string, known []string) error {
+	var keys []string
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		found := false
+		for _, k := range known {
+			found = found || key == k
+		}
+		if !found {
+			return fmt.Errorf("%s has an unknown key %s%s, the known ones are %s", manifestName, prefix, key, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+// validateManifest adds the problems in m to problems.
+func validateManifest(problems *sourceProblems, m *manifest) {
+	if m.Build.Type != "" {
+		if _, _, err := getForcedBuildType(map[string]interface{}{buildTypeKey: m.Build.Type}); err != nil {
+			problems.errorf("%s: build.type %s isn't a build type, must be %s, %s or %s", manifestName, m.Build.Type, buildTypeProcfile, buildTypeDockerfile, buildTypeCNB)
+		}
+	}
+	for i, bp := range m.Build.Buildpacks {
+		if strings.TrimSpace(bp) == "" {
+			problems.errorf("%s: build.buildpacks[%d] is empty", manifestName, i)
+		}
+	}
+	if len(m.Build.Buildpacks) > 1 && buildType(m.Build.Type) == buildTypeProcfile {
+		problems.errorf("%s: build.buildpacks has %d buildpacks, but %s builds take a single one", manifestName, len(m.Build.Buildpacks), buildTypeProcfile)
+	}
+	if m.Build.Dockerfile != "" {
+		if _, err := sourcePath(map[string]interface{}{dockerfileKey: m.Build.Dockerfile}, nil, dockerfileKey, ""); err != nil {
+			problems.errorf("%s: build.dockerfile %s must be a path inside the source", manifestName, m.Build.Dockerfile)
+		}
+	}
+	for _, name := range sortedKeys(m.Build.Args) {
+		if !envVarName.MatchString(name) {
+			problems.errorf("%s: build.args has an invalid name %q", manifestName, name)
+		}
+	}
+	for _, name := range sortedKeys(m.Build.Resources) {
+		if name != string(api.ResourceCPU) && name != string(api.ResourceMemory) {
+			problems.errorf("%s: build.resources has an unknown resource %s, must be %s or %s", manifestName, name, api.ResourceCPU, api.ResourceMemory)
+			continue
+		}
+		if _, err := resource.ParseQuantity(m.Build.Resources[name]); err != nil {
+			problems.errorf("%s: build.resources.%s %s isn't a quantity (%s)", manifestName, name, m.Build.Resources[name], err)
+		}
+	}
+	for _, name := range sortedKeys(m.Processes) {
+		if strings.TrimSpace(m.Processes[name]) == "" {
+			problems.errorf("%s: process type %s has no command", manifestName, name)
+		}
+	}
+}
+
+// buildType returns the build type that m forces, and false if it doesn't force one. The app
+// config forces a build type over m.
+func (m *manifest) buildType(values map[string]interface{}) (buildType, bool, error) {
+	bType, forced, err := getForcedBuildType(values)
+	if err != nil || forced || m == nil || m.Build.Type == "" {
+		return bType, forced, err
+	}
+	return buildType(m.Build.Type), true, nil
+}
+
+// dockerfile sets the Dockerfile path of src to the one in m, unless the app config values or push
+// options opts set it.
+func (m *manifest) dockerfile(src *buildSource, values map[string]interface{}, opts pushOptions) {
+	if m == nil || m.Build.Dockerfile == "" {
+		return
+	}
+	if _, ok := values[dockerfileKey]; ok {
+		return
+	}
+	if _, ok := opts[pushOptionDockerfile]; ok {
+		return
+	}
+	src.dockerfile, _ = sourcePath(map[string]interface{}{dockerfileKey: m.Build.Dockerfile}, nil, dockerfileKey, "")
+}
+
+// buildpackURL returns buildpackURL, the one that the app config sets, or else the buildpack in m.
+func (m *manifest) buildpackURL(buildpackURL string) string {
+	if buildpackURL != "" || m == nil || len(m.Build.Buildpacks) == 0 {
+		return buildpackURL
+	}
+	return m.Build.Buildpacks[0]
+}
+
+// buildpacks returns the buildpacks in m.
+func (m *manifest) buildpacks() []string {
+	if m == nil {
+		return nil
+	}
+	return m.Build.Buildpacks
+}
+
+// dockerBuildArgs returns the build args of a Dockerfile build: the app config values, if they
+// enable build args, over the args in m. It returns nil if there are none.
+func (m *manifest) dockerBuildArgs(values map[string]interface{}) map[string]interface{} {
+	args := map[string]interface{}{}
+	if m != nil {
+		for key, val := range m.Build.Args {
+			args[key] = val
+		}
+	}
+	if _, ok := values[dockerBuildArgsKey]; ok {
+		for key, val := range values {
+			args[key] = val
+		}
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return args
+}
+
+// resources returns the resources that the builder pod requests according to m.
+func (m *manifest) resources() api.ResourceList {
+	if m == nil || len(m.Build.Resources) == 0 {
+		return nil
+	}
+	list := api.ResourceList{}
+	for name, val := range m.Build.Resources {
+		if q, err := resource.ParseQuantity(val); err == nil {
+			list[api.ResourceName(name)] = *q
+		}
+	}
+	return list
+}
+
+// processTypes merges the process types in m with procType, those of the Procfile or, without
+// one, the buildpack's defaults. A Procfile takes precedence over m, and m over the buildpack.
+func (m *manifest) processTypes(procType deisAPI.ProcessType, hasProcfile bool) deisAPI.ProcessType {
+	if m == nil || len(m.Processes) == 0 {
+		return procType
+	}
+	merged := deisAPI.ProcessType{}
+	for name, command := range procType {
+		merged[name] = command
+	}
+	for name, command := range m.Processes {
+		if _, ok := merged[name]; !ok || !hasProcfile {
+			merged[name] = command
+		}
+	}
+	return merged
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
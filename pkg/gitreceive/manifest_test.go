@@ -0,0 +1,159 @@
+package gitreceive
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/arschles/assert"
+	deisAPI "github.com/deis/controller-sdk-go/api"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+const testManifest = `build:
+  type: dockerfile
+  dockerfile: docker/Dockerfile
+  args:
+    GO_VERSION: "1.6"
+  resources:
+    cpu: 500m
+    memory: 1Gi
+processes:
+  web: ./server
+`
+
+func writeManifest(t *testing.T, data string) string {
+	dir, err := ioutil.TempDir("", "manifest")
+	assert.NoErr(t, err)
+	assert.NoErr(t, ioutil.WriteFile(dir+"/deis.yaml", []byte(data), 0644))
+	return dir
+}
+
+func TestReadManifest(t *testing.T) {
+	dir := writeManifest(t, testManifest)
+	defer os.RemoveAll(dir)
+	m, err := readManifest(dir)
+	assert.NoErr(t, err)
+	assert.Equal(t, m.Build.Type, "dockerfile", "build type")
+	assert.Equal(t, m.Build.Dockerfile, "docker/Dockerfile", "dockerfile")
+	assert.Equal(t, m.Build.Args["GO_VERSION"], "1.6", "build arg")
+	assert.Equal(t, m.Processes["web"], "./server", "web process")
+
+	var problems sourceProblems
+	validateManifest(&problems, m)
+	assert.NoErr(t, problems.err())
+
+	empty, err := ioutil.TempDir("", "manifest")
+	assert.NoErr(t, err)
+	defer os.RemoveAll(empty)
+	m, err = readManifest(empty)
+	assert.NoErr(t, err)
+	if m != nil {
+		t.Errorf("expected no manifest, got %+v", m)
+	}
+}
+
+func TestReadManifestErrors(t *testing.T) {
+	tests := map[string]string{
+		"build:\n  type: [dockerfile\n":     "deis.yaml is malformed",
+		"biuld:\n  type: dockerfile\n":      "deis.yaml has an unknown key biuld, the known ones are build, processes",
+		"build:\n  dockerfle: Dockerfile\n": "deis.yaml has an unknown key build.dockerfle",
+		"processes: [web]\n":                "deis.yaml is malformed",
+	}
+	for data, expected := range tests {
+		dir := writeManifest(t, data)
+		_, err := readManifest(dir)
+		os.RemoveAll(dir)
+		if err == nil || !strings.HasPrefix(err.Error(), expected) {
+			t.Errorf("expected an error starting with %q for %q, got %v", expected, data, err)
+		}
+	}
+}
+
+func TestValidateManifest(t *testing.T) {
+	m := &manifest{
+		Build: manifestBuild{
+			Type:       "heroku",
+			Buildpacks: []string{""},
+			Dockerfile: "../Dockerfile",
+			Args:       map[string]string{"1ARG": "x"},
+			Resources:  map[string]string{"cpu": "lots", "gpu": "1"},
+		},
+		Processes: map[string]string{"web": ""},
+	}
+	var problems sourceProblems
+	validateManifest(&problems, m)
+	assert.Equal(t, strings.Join(problems.errors, "\n"), strings.Join([]string{
+		"deis.yaml: build.type heroku isn't a build type, must be procfile, dockerfile or cnb",
+		"deis.yaml: build.buildpacks[0] is empty",
+		"deis.yaml: build.dockerfile ../Dockerfile must be a path inside the source",
+		`deis.yaml: build.args has an invalid name "1ARG"`,
+		"deis.yaml: build.resources.cpu lots isn't a quantity (quantities must match the regular expression '^([+-]?[0-9.]+)([eEinumkKMGTP]*[-+]?[0-9]*)$')",
+		"deis.yaml: build.resources has an unknown resource gpu, must be cpu or memory",
+		"deis.yaml: process type web has no command",
+	}, "\n"), "errors")
+
+	problems = sourceProblems{}
+	validateManifest(&problems, &manifest{Build: manifestBuild{Type: "procfile", Buildpacks: []string{"a", "b"}}})
+	assert.Equal(t, len(problems.errors), 1, "number of errors")
+}
+
+func TestManifestPrecedence(t *testing.T) {
+	var none *manifest
+	m := &manifest{
+		Build: manifestBuild{
+			Type:       "cnb",
+			Buildpacks: []string{"https://example.com/bp"},
+			Dockerfile: "docker/Dockerfile",
+			Args:       map[string]string{"A": "manifest", "B": "manifest"},
+			Resources:  map[string]string{"cpu": "500m"},
+		},
+		Processes: map[string]string{"web": "./manifest-web", "worker": "./manifest-worker"},
+	}
+
+	bType, forced, err := m.buildType(map[string]interface{}{})
+	assert.NoErr(t, err)
+	assert.True(t, forced, "expected the manifest to force the build type")
+	assert.Equal(t, bType, buildTypeCNB, "build type")
+	bType, _, err = m.buildType(map[string]interface{}{"DEIS_BUILD_TYPE": "dockerfile"})
+	assert.NoErr(t, err)
+	assert.Equal(t, bType, buildTypeDockerfile, "build type set by the app config")
+	_, forced, err = none.buildType(map[string]interface{}{})
+	assert.NoErr(t, err)
+	assert.False(t, forced, "build type forced without a manifest")
+
+	src := buildSource{dockerfile: "Dockerfile"}
+	m.dockerfile(&src, map[string]interface{}{"DEIS_DOCKERFILE": "Dockerfile"}, pushOptions{})
+	assert.Equal(t, src.dockerfile, "Dockerfile", "dockerfile set by the app config")
+	m.dockerfile(&src, map[string]interface{}{}, pushOptions{"dockerfile": "Dockerfile"})
+	assert.Equal(t, src.dockerfile, "Dockerfile", "dockerfile set by a push option")
+	m.dockerfile(&src, map[string]interface{}{}, pushOptions{})
+	assert.Equal(t, src.dockerfile, "docker/Dockerfile", "dockerfile set by the manifest")
+
+	assert.Equal(t, m.buildpackURL(""), "https://example.com/bp", "buildpack set by the manifest")
+	assert.Equal(t, m.buildpackURL("https://example.com/config"), "https://example.com/config", "buildpack set by the app config")
+	assert.Equal(t, none.buildpackURL(""), "", "buildpack without a manifest")
+
+	args := m.dockerBuildArgs(map[string]interface{}{"B": "config"})
+	assert.Equal(t, args["B"], "manifest", "build arg without build args enabled in the app config")
+	args = m.dockerBuildArgs(map[string]interface{}{"B": "config", "DEIS_DOCKER_BUILD_ARGS_ENABLED": "1"})
+	assert.Equal(t, args["A"], "manifest", "build arg only in the manifest")
+	assert.Equal(t, args["B"], "config", "build arg set by the app config")
+	if args := none.dockerBuildArgs(map[string]interface{}{"B": "config"}); args != nil {
+		t.Errorf("expected no build args, got %v", args)
+	}
+
+	resources := m.resources()
+	cpu := resources[api.ResourceCPU]
+	assert.Equal(t, cpu.String(), "500m", "cpu")
+	if resources := none.resources(); resources != nil {
+		t.Errorf("expected no resources, got %v", resources)
+	}
+
+	procType := m.processTypes(deisAPI.ProcessType{"web": "./procfile-web"}, true)
+	assert.Equal(t, procType["web"], "./procfile-web", "web process set by the Procfile")
+	assert.Equal(t, procType["worker"], "./manifest-worker", "worker process set by the manifest")
+	procType = m.processTypes(deisAPI.ProcessType{"web": "./buildpack-web"}, false)
+	assert.Equal(t, procType["web"], "./manifest-web", "web process set by the manifest over the buildpack")
+}
@@ -0,0 +1,207 @@
+package gitreceive
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[1;36m"
+
+	phasePrefix = "-----> "
+	indent      = "       "
+
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+// buildPhase is a step of a build, as reported to the pushing client.
+type buildPhase string
+
+func (b buildPhase) String() string {
+	return string(b)
+}
+
+const (
+	phaseArchive  buildPhase = "Archiving source"
+	phaseUpload   buildPhase = "Uploading source"
+	phaseSchedule buildPhase = "Scheduling build pod"
+	phaseBuild    buildPhase = "Building"
+	phaseRelease  buildPhase = "Releasing"
+	// phaseCheck runs the build checks, after phaseBuild.
+	phaseCheck buildPhase = "Checking build"
+	// phaseReleaseCommand runs the app's release command, before phaseRelease.
+	phaseReleaseCommand buildPhase = "Running release command"
+)
+
+// progressWriter renders the progress of a build for the pushing git client. Everything the hook
+// writes to the client should go through a single progressWriter, so that phase lines, keepalive
+// lines and build logs never interleave in the middle of a line.
+//
+// Git relays the hook's output over the sideband, prefixing every line with "remote: ". Without
+// color, status lines start with the "error:" keyword, which git clients highlight themselves
+// when, and only when, they're writing to a terminal. With color, the lines carry their own ANSI
+// escape codes regardless of the client.
+type progressWriter struct {
+	mu          sync.Mutex
+	out         io.Writer
+	color       bool
+	now         func() time.Time
+	phase       buildPhase
+	started     time.Time
+	atLineStart bool
+}
+
+// newProgressWriter returns a progressWriter that writes to out, using ANSI colors if color is
+// true.
+func newProgressWriter(out io.Writer, color bool) *progressWriter {
+	return &progressWriter{out: out, color: color, now: time.Now, atLineStart: true}
+}
+
+// begin ends the current phase, if any, and starts ph.
+func (p *progressWriter) begin(ph buildPhase) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.endLocked()
+	p.phase = ph
+	p.started = p.now()
+	p.line(p.paint(ansiCyan, phasePrefix) + ph.String())
+}
+
+// end ends the current phase, reporting how long it took.
+func (p *progressWriter) end() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.endLocked()
+}
+
+// fail ends the current phase as failed. It does nothing if no phase is in progress.
+func (p *progressWriter) fail() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.phase == "" {
+		return
+	}
+	p.line(fmt.Sprintf("%s %s failed after %s", p.paint(ansiRed, "error:"), p.phase, p.elapsed()))
+	p.phase = ""
+}
+
+// printf writes an indented line of information about the current phase.
+func (p *progressWriter) printf(format string, args ...interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.line(indent + fmt.Sprintf(format, args...))
+}
+
+// warnf writes an indented warning about the current phase.
+func (p *progressWriter) warnf(format string, args ...interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.line(indent + p.paint(ansiYellow, "warning:") + " " + fmt.Sprintf(format, args...))
+}
+
+// keepalive writes a line every interval while the current phase is in progress, so the client
+// knows the build hasn't stalled. Call the returned func to stop it.
+func (p *progressWriter) keepalive(interval time.Duration) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+	ticker := time.NewTicker(interval)
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				p.still()
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(stopCh)
+		<-doneCh
+	}
+}
+
+// Write is the io.Writer interface implementation. It passes b through untouched, for output
+// such as build logs.
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(b) == 0 {
+		return 0, nil
+	}
+	n, err := p.out.Write(b)
+	if n > 0 {
+		p.atLineStart = b[n-1] == '\n'
+	}
+	return n, err
+}
+
+func (p *progressWriter) still() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.phase == "" {
+		return
+	}
+	msg := fmt.Sprintf("still %s (%s)", strings.ToLower(p.phase.String()), p.elapsed())
+	p.line(indent + p.paint(ansiYellow, msg))
+}
+
+func (p *progressWriter) endLocked() {
+	if p.phase == "" {
+		return
+	}
+	p.line(indent + p.paint(ansiGreen, "done") + " in " + p.elapsed().String())
+	p.phase = ""
+}
+
+// line writes s on a line of its own. p.mu must be held.
+func (p *progressWriter) line(s string) {
+	if !p.atLineStart {
+		s = "\n" + s
+	}
+	fmt.Fprintln(p.out, s)
+	p.atLineStart = true
+}
+
+func (p *progressWriter) paint(code, s string) string {
+	if !p.color {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// elapsed returns the time spent in the current phase, rounded to a tenth of a second.
+func (p *progressWriter) elapsed() time.Duration {
+	d := p.now().Sub(p.started)
+	return d - d%(100*time.Millisecond)
+}
+
+// useColor determines whether build output should be colored. A "color" push option
+// (git push -o color, -o color=always or -o color=never) takes precedence over the builder-wide
+// default. Any other value of the option is ignored, with an error to warn the client about.
+func useColor(conf *Config, opts pushOptions) (bool, error) {
+	val, ok := opts[pushOptionColor]
+	switch {
+	case !ok:
+	case val == "" || val == colorAlways:
+		return true, nil
+	case val == colorNever:
+		return false, nil
+	default:
+		return conf.OutputColor == colorAlways, fmt.Errorf("ignoring the push option %s=%s, must be %s or %s", pushOptionColor, val, colorAlways, colorNever)
+	}
+	return conf.OutputColor == colorAlways, nil
+}
@@ -0,0 +1,135 @@
+package gitreceive
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arschles/assert"
+)
+
+// fakeClock returns a progressWriter clock that starts at the zero time and advances by step
+// every time it's read.
+func fakeClock(step time.Duration) func() time.Time {
+	var now time.Time
+	return func() time.Time {
+		now = now.Add(step)
+		return now
+	}
+}
+
+func TestProgressWriterPhases(t *testing.T) {
+	var buf bytes.Buffer
+	out := newProgressWriter(&buf, false)
+	out.now = fakeClock(1500 * time.Millisecond)
+
+	out.begin(phaseArchive)
+	out.printf("%d files", 3)
+	out.begin(phaseBuild)
+	out.Write([]byte("log line without a newline"))
+	out.still()
+	out.end()
+	out.begin(phaseRelease)
+	out.fail()
+
+	expected := strings.Join([]string{
+		"-----> Archiving source",
+		"       3 files",
+		"       done in 1.5s",
+		"-----> Building",
+		"log line without a newline",
+		"       still building (1.5s)",
+		"       done in 3s",
+		"-----> Releasing",
+		"error: Releasing failed after 1.5s",
+		"",
+	}, "\n")
+	assert.Equal(t, buf.String(), expected, "output")
+}
+
+func TestProgressWriterNoPhase(t *testing.T) {
+	var buf bytes.Buffer
+	out := newProgressWriter(&buf, false)
+	out.end()
+	out.fail()
+	out.still()
+	assert.Equal(t, buf.String(), "", "output without a phase")
+}
+
+func TestProgressWriterColor(t *testing.T) {
+	var buf bytes.Buffer
+	out := newProgressWriter(&buf, true)
+	out.now = fakeClock(time.Second)
+	out.begin(phaseUpload)
+	out.fail()
+	expected := ansiCyan + phasePrefix + ansiReset + "Uploading source\n" +
+		ansiRed + "error:" + ansiReset + " Uploading source failed after 1s\n"
+	assert.Equal(t, buf.String(), expected, "colored output")
+}
+
+func TestProgressWriterKeepalive(t *testing.T) {
+	var buf bytes.Buffer
+	out := newProgressWriter(&buf, false)
+	out.begin(phaseSchedule)
+	stop := out.keepalive(time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	stop()
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	assert.True(t, strings.Contains(buf.String(), "still scheduling build pod"), "no keepalive in output:\n%s", buf.String())
+
+	// a non-positive interval disables the keepalive
+	out.keepalive(0)()
+}
+
+func TestUseColor(t *testing.T) {
+	conf := &Config{OutputColor: colorNever}
+	for _, c := range []struct {
+		opts  pushOptions
+		color bool
+	}{
+		{pushOptions{}, false},
+		{pushOptions{"color": ""}, true},
+		{pushOptions{"color": colorAlways}, true},
+		{pushOptions{"color": colorNever}, false},
+	} {
+		color, err := useColor(conf, c.opts)
+		assert.NoErr(t, err)
+		assert.Equal(t, color, c.color, fmt.Sprintf("color with OutputColor never and %v", c.opts))
+	}
+
+	conf.OutputColor = colorAlways
+	color, err := useColor(conf, pushOptions{})
+	assert.NoErr(t, err)
+	assert.True(t, color, "color with OutputColor always")
+	color, err = useColor(conf, pushOptions{"color": colorNever})
+	assert.NoErr(t, err)
+	assert.False(t, color, "color with color=never")
+
+	// unknown values fall back to the builder-wide default.
+	for _, val := range []string{"off", "nevr"} {
+		conf.OutputColor = colorNever
+		color, err = useColor(conf, pushOptions{"color": val})
+		if err == nil {
+			t.Errorf("expected an error for color=%s", val)
+		}
+		assert.False(t, color, "color with color=%s and OutputColor never", val)
+		conf.OutputColor = colorAlways
+		color, _ = useColor(conf, pushOptions{"color": val})
+		assert.True(t, color, "color with color=%s and OutputColor always", val)
+	}
+}
+
+func TestProgressWriterWarning(t *testing.T) {
+	var buf bytes.Buffer
+	out := newProgressWriter(&buf, false)
+	out.warnf("no %s", "web")
+	assert.Equal(t, buf.String(), "       warning: no web\n", "output")
+
+	buf.Reset()
+	out = newProgressWriter(&buf, true)
+	out.warnf("no %s", "web")
+	assert.Equal(t, buf.String(), indent+ansiYellow+"warning:"+ansiReset+" no web\n", "colored output")
+}
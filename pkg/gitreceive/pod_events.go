@@ -0,0 +1,78 @@
+package gitreceive
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// Reasons the kubelet and scheduler give for a build pod not making progress. They're plain
+// strings in the API, so they're spelled out here rather than pulled in from the kubelet packages.
+const (
+	reasonImagePullBackOff  = "ImagePullBackOff"
+	reasonErrImageNeverPull = "ErrImageNeverPull"
+	reasonInvalidImageName  = "InvalidImageName"
+	reasonOOMKilled         = "OOMKilled"
+	reasonEvicted           = "Evicted"
+	reasonFailedScheduling  = "FailedScheduling"
+)
+
+// eventHints are the suggestions shown next to warning events that usually need an operator's
+// attention.
+var eventHints = map[string]string{
+	reasonFailedScheduling: "no node can run the build pod yet; check the cluster's capacity and BUILDER_POD_NODE_SELECTOR",
+}
+
+// podEventReporter writes the warning events recorded against a build pod to the pushing client,
+// so that the reason a build is stuck shows up in the push output instead of only in the cluster.
+// Events that are recorded again with the same reason and message are only reported once.
+type podEventReporter struct {
+	mu   sync.Mutex
+	out  *progressWriter
+	seen map[string]bool
+}
+
+func newPodEventReporter(out *progressWriter) *podEventReporter {
+	return &podEventReporter{out: out, seen: make(map[string]bool)}
+}
+
+// report is meant to be passed as the handler to k8s.NewPodEventWatcher.
+func (r *podEventReporter) report(event *api.Event) {
+	if event.Type != api.EventTypeWarning {
+		return
+	}
+	key := event.Reason + "\x00" + event.Message
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.seen[key] {
+		return
+	}
+	r.seen[key] = true
+	r.out.printf("%s: %s", event.Reason, event.Message)
+	if hint, ok := eventHints[event.Reason]; ok {
+		r.out.printf("(%s)", hint)
+	}
+}
+
+// podFailure returns an error describing why pod will never finish its build, or nil if it may
+// still make progress or simply failed the build. The error tells the user what to do about it.
+func podFailure(pod *api.Pod) error {
+	if pod.Status.Phase == api.PodFailed && pod.Status.Reason == reasonEvicted {
+		return fmt.Errorf("the build pod was evicted from its node: %s\nThe node is likely short on resources; push again to retry the build", pod.Status.Message)
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if waiting := status.State.Waiting; waiting != nil {
+			switch waiting.Reason {
+			// a single ErrImagePull may be a registry hiccup; by the time the kubelet backs off, the
+			// pull has failed repeatedly.
+			case reasonImagePullBackOff, reasonErrImageNeverPull, reasonInvalidImageName:
+				return fmt.Errorf("the builder image %s could not be pulled (%s: %s)\nCheck the builder image settings and that the node can reach its registry", status.Image, waiting.Reason, waiting.Message)
+			}
+		}
+		if terminated := status.State.Terminated; terminated != nil && terminated.Reason == reasonOOMKilled {
+			return fmt.Errorf("the build ran out of memory and was killed (%s)\nReduce the build's memory use, or raise the memory available to build pods", reasonOOMKilled)
+		}
+	}
+	return nil
+}
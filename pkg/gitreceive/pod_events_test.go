@@ -0,0 +1,111 @@
+package gitreceive
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arschles/assert"
+	"github.com/deis/builder/pkg/k8s"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+func waitingPod(reason string) *api.Pod {
+	return &api.Pod{
+		ObjectMeta: api.ObjectMeta{Name: "build", Namespace: "deis", Labels: map[string]string{"heritage": "build"}},
+		Status: api.PodStatus{
+			Phase: api.PodPending,
+			ContainerStatuses: []api.ContainerStatus{
+				{Image: "quay.io/deis/slugbuilder:canary", State: api.ContainerState{Waiting: &api.ContainerStateWaiting{Reason: reason}}},
+			},
+		},
+	}
+}
+
+func TestPodFailure(t *testing.T) {
+	for _, reason := range []string{"ContainerCreating", "ErrImagePull"} {
+		if err := podFailure(waitingPod(reason)); err != nil {
+			t.Errorf("expected a pod waiting with %s to be recoverable, got %s", reason, err)
+		}
+	}
+
+	for _, reason := range []string{reasonImagePullBackOff, reasonInvalidImageName, reasonErrImageNeverPull} {
+		err := podFailure(waitingPod(reason))
+		if err == nil || !strings.Contains(err.Error(), "quay.io/deis/slugbuilder:canary could not be pulled") {
+			t.Errorf("expected a pod waiting with %s to fail with an image pull error, got %v", reason, err)
+		}
+	}
+
+	evicted := &api.Pod{Status: api.PodStatus{Phase: api.PodFailed, Reason: reasonEvicted, Message: "The node was low on memory."}}
+	err := podFailure(evicted)
+	if err == nil || !strings.Contains(err.Error(), "evicted from its node: The node was low on memory.") {
+		t.Errorf("expected an eviction error, got %v", err)
+	}
+
+	oomKilled := &api.Pod{Status: api.PodStatus{
+		Phase: api.PodFailed,
+		ContainerStatuses: []api.ContainerStatus{
+			{State: api.ContainerState{Terminated: &api.ContainerStateTerminated{ExitCode: 137, Reason: reasonOOMKilled}}},
+		},
+	}}
+	err = podFailure(oomKilled)
+	if err == nil || !strings.Contains(err.Error(), "ran out of memory") {
+		t.Errorf("expected an out of memory error, got %v", err)
+	}
+
+	// a build that merely exits non-zero is reported by its exit code instead.
+	failed := &api.Pod{Status: api.PodStatus{
+		Phase: api.PodFailed,
+		ContainerStatuses: []api.ContainerStatus{
+			{State: api.ContainerState{Terminated: &api.ContainerStateTerminated{ExitCode: 1, Reason: "Error"}}},
+		},
+	}}
+	assert.NoErr(t, podFailure(failed))
+}
+
+func TestPodEventReporter(t *testing.T) {
+	var buf bytes.Buffer
+	r := newPodEventReporter(newProgressWriter(&buf, false))
+
+	scheduling := &api.Event{Type: api.EventTypeWarning, Reason: reasonFailedScheduling, Message: "no nodes available to schedule pods"}
+	r.report(&api.Event{Type: api.EventTypeNormal, Reason: "Scheduled", Message: "Successfully assigned build to node-1"})
+	r.report(scheduling)
+	r.report(scheduling)
+	r.report(&api.Event{Type: api.EventTypeWarning, Reason: "Failed", Message: "Failed to pull image"})
+
+	expected := strings.Join([]string{
+		"       FailedScheduling: no nodes available to schedule pods",
+		"       (" + eventHints[reasonFailedScheduling] + ")",
+		"       Failed: Failed to pull image",
+		"",
+	}, "\n")
+	assert.Equal(t, buf.String(), expected, "reported events")
+}
+
+func TestWaitForPodFailsFast(t *testing.T) {
+	pw := &k8s.PodWatcher{}
+	pw.Store.Store = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	assert.NoErr(t, pw.Store.Add(waitingPod(reasonImagePullBackOff)))
+
+	var buf bytes.Buffer
+	start := time.Now()
+	err := waitForPod(newProgressWriter(&buf, false), pw, "deis", "build", 0, time.Minute)
+	if err == nil || !strings.Contains(err.Error(), "could not be pulled") {
+		t.Errorf("expected an image pull error, got %v", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("waitForPod took %s to give up on a pod that can't start", time.Since(start))
+	}
+}
+
+func TestWaitForPodEndTimeout(t *testing.T) {
+	pw := &k8s.PodWatcher{}
+	pw.Store.Store = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	assert.NoErr(t, pw.Store.Add(waitingPod("ContainerCreating")))
+
+	err := waitForPodEnd(pw, "deis", "build", 50*time.Millisecond)
+	assert.Equal(t, err, wait.ErrWaitTimeout, "error")
+}
@@ -0,0 +1,184 @@
+package gitreceive
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/deis/builder/pkg/k8s"
+	"github.com/deis/pkg/log"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+// maxLogRetry caps the time between two attempts to reconnect to the build logs.
+const maxLogRetry = 5 * time.Second
+
+// logFollower copies the logs of a build container to out until the container terminates,
+// reconnecting whenever the stream from the API server ends early.
+//
+// Logs are requested with timestamps, which lets a reconnection ask for the lines since the last
+// one written and skip those that were already copied. Only whole lines are copied while the
+// container runs, so a line cut in half by a dropped connection is written once, in full, after
+// reconnecting.
+type logFollower struct {
+	out io.Writer
+	// open opens a log stream with the given options.
+	open func(opts *api.PodLogOptions) (io.ReadCloser, error)
+	// finished reports whether the container has terminated, so no more logs will come.
+	finished func() bool
+	// retry is the initial wait between reconnections, doubled after every attempt that doesn't
+	// yield any logs.
+	retry   time.Duration
+	timeout time.Duration
+
+	last    time.Time // timestamp of the last line written
+	seen    int       // number of lines written with timestamp last
+	partial string    // unterminated last line of the most recent stream
+	written int64     // bytes written to out
+}
+
+// run follows the logs until the container terminates, or returns an error if they can't be
+// followed for f.timeout: the time since the last stream that yielded logs, or since the first
+// attempt to open the logs if none did, so that builds of any length keep their logs.
+func (f *logFollower) run() error {
+	wait := f.retry
+	var failingSince time.Time
+	for {
+		lines, err := f.follow(true)
+		if f.finished() {
+			if err != nil && err != io.EOF {
+				// the stream broke off, so the container's last lines may not have been copied yet.
+				if _, err := f.follow(false); err != nil && err != io.EOF {
+					log.Debug("Unable to fetch the end of the build logs (%s)", err)
+				}
+			}
+			return f.flush()
+		}
+
+		if err == nil || err == io.EOF {
+			err = fmt.Errorf("log stream ended before the build container terminated")
+		}
+		if lines > 0 {
+			wait, failingSince = f.retry, time.Time{}
+		}
+		if failingSince.IsZero() {
+			failingSince = time.Now()
+		} else if time.Since(failingSince) > f.timeout {
+			return fmt.Errorf("giving up on the build logs after %s without any (%s)", f.timeout, err)
+		}
+		log.Debug("Reconnecting to the build logs in %s (%s)", wait, err)
+		time.Sleep(wait)
+		if wait *= 2; wait > maxLogRetry {
+			wait = maxLogRetry
+		}
+	}
+}
+
+// follow opens the logs since the last line written, following them if follow is true, and copies
+// them to f.out. It returns how many lines it copied.
+func (f *logFollower) follow(follow bool) (int, error) {
+	opts := &api.PodLogOptions{Follow: follow, Timestamps: true}
+	if !f.last.IsZero() {
+		since := unversioned.NewTime(f.last)
+		opts.SinceTime = &since
+	}
+	rc, err := f.open(opts)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	return f.copy(rc)
+}
+
+// copy writes the new lines of r to f.out, returning how many it wrote.
+func (f *logFollower) copy(r io.Reader) (int, error) {
+	br := bufio.NewReader(r)
+	// after a reconnection, the first lines stamped f.last have already been written.
+	skip := f.seen
+	f.partial = ""
+	lines := 0
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			f.partial = line
+			return lines, err
+		}
+
+		ts, text, ok := splitLogTimestamp(line)
+		if ok {
+			if ts.Before(f.last) {
+				continue
+			}
+			if ts.Equal(f.last) {
+				if skip > 0 {
+					skip--
+					continue
+				}
+				f.seen++
+			} else {
+				f.last, f.seen, skip = ts, 1, 0
+			}
+		}
+
+		if err := f.write(text); err != nil {
+			return lines, err
+		}
+		lines++
+	}
+}
+
+// flush writes the unterminated line the container ended its logs with, if any.
+func (f *logFollower) flush() error {
+	if f.partial == "" {
+		return nil
+	}
+	_, text, _ := splitLogTimestamp(f.partial)
+	f.partial = ""
+	return f.write(text)
+}
+
+func (f *logFollower) write(s string) error {
+	n, err := io.WriteString(f.out, s)
+	f.written += int64(n)
+	return err
+}
+
+// splitLogTimestamp splits a log line requested with timestamps into its timestamp and the line as
+// the container wrote it. ok is false if line doesn't start with a timestamp.
+func splitLogTimestamp(line string) (ts time.Time, text string, ok bool) {
+	i := strings.IndexByte(line, ' ')
+	if i < 0 {
+		return time.Time{}, line, false
+	}
+	ts, err := time.Parse(time.RFC3339Nano, line[:i])
+	if err != nil {
+		return time.Time{}, line, false
+	}
+	return ts, line[i+1:], true
+}
+
+// containerTerminated returns a func that reports whether the build container of the pod podName
+// has terminated, according to pw.
+func containerTerminated(pw *k8s.PodWatcher, podName string) func() bool {
+	selector := labels.Set{"heritage": podName}.AsSelector()
+	return func() bool {
+		pods, err := pw.Store.List(selector)
+		if err != nil || len(pods) == 0 {
+			return false
+		}
+		pod := pods[0]
+		if pod.Status.Phase == api.PodSucceeded || pod.Status.Phase == api.PodFailed {
+			return true
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.State.Terminated == nil {
+				return false
+			}
+		}
+		return len(pod.Status.ContainerStatuses) > 0
+	}
+}
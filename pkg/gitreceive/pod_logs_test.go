@@ -0,0 +1,179 @@
+package gitreceive
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arschles/assert"
+	"github.com/deis/builder/pkg/k8s"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+)
+
+type failingReader struct{ err error }
+
+func (f failingReader) Read([]byte) (int, error) {
+	return 0, f.err
+}
+
+// fakeLogStreams returns an open func for a logFollower that serves streams in order, recording
+// the options it was called with.
+func fakeLogStreams(streams []io.Reader, calls *[]*api.PodLogOptions) func(*api.PodLogOptions) (io.ReadCloser, error) {
+	return func(opts *api.PodLogOptions) (io.ReadCloser, error) {
+		*calls = append(*calls, opts)
+		if len(*calls) > len(streams) {
+			return nil, errors.New("no more streams")
+		}
+		return ioutil.NopCloser(streams[len(*calls)-1]), nil
+	}
+}
+
+func TestLogFollowerResumes(t *testing.T) {
+	dropped := errors.New("connection reset by peer")
+	streams := []io.Reader{
+		io.MultiReader(strings.NewReader(strings.Join([]string{
+			"2016-06-01T12:00:00.1Z -----> Fetching buildpack\n",
+			"2016-06-01T12:00:01.5Z step 1\n",
+			"2016-06-01T12:00:01.5Z step 2\n",
+			"2016-06-01T12:00:02.0Z step 3 is cut",
+		}, "")), failingReader{dropped}),
+		// the reconnection gets everything from the start of the second of the last line written.
+		strings.NewReader(strings.Join([]string{
+			"2016-06-01T12:00:01.2Z step 0.5\n",
+			"2016-06-01T12:00:01.5Z step 1\n",
+			"2016-06-01T12:00:01.5Z step 2\n",
+			"2016-06-01T12:00:02.0Z step 3 is cut in half\n",
+			"2016-06-01T12:00:03.0Z done, without a newline",
+		}, "")),
+	}
+	var calls []*api.PodLogOptions
+	var buf bytes.Buffer
+	f := &logFollower{
+		out:      &buf,
+		open:     fakeLogStreams(streams, &calls),
+		finished: func() bool { return len(calls) == len(streams) },
+		retry:    time.Millisecond,
+		timeout:  time.Minute,
+	}
+	assert.NoErr(t, f.run())
+
+	expected := strings.Join([]string{
+		"-----> Fetching buildpack",
+		"step 1",
+		"step 2",
+		"step 3 is cut in half",
+		"done, without a newline",
+	}, "\n")
+	assert.Equal(t, buf.String(), expected, "logs")
+	assert.Equal(t, f.written, int64(len(expected)), "bytes written")
+
+	assert.Equal(t, len(calls), 2, "number of streams opened")
+	for _, opts := range calls {
+		assert.True(t, opts.Follow && opts.Timestamps, "expected logs to be followed with timestamps, got %+v", opts)
+	}
+	assert.True(t, calls[0].SinceTime == nil, "expected the first stream to start at the beginning")
+	since := time.Date(2016, 6, 1, 12, 0, 1, 500000000, time.UTC)
+	if calls[1].SinceTime == nil || !calls[1].SinceTime.Time.Equal(since) {
+		t.Errorf("expected the second stream to start at %s, got %v", since, calls[1].SinceTime)
+	}
+}
+
+func TestLogFollowerTimeout(t *testing.T) {
+	var calls []*api.PodLogOptions
+	f := &logFollower{
+		out:      ioutil.Discard,
+		open:     fakeLogStreams(nil, &calls),
+		finished: func() bool { return false },
+		retry:    time.Millisecond,
+		timeout:  20 * time.Millisecond,
+	}
+	err := f.run()
+	if err == nil || !strings.Contains(err.Error(), "no more streams") {
+		t.Errorf("expected the last stream error, got %v", err)
+	}
+	assert.True(t, len(calls) > 1, "expected more than one attempt to open the logs, got %d", len(calls))
+}
+
+func TestLogFollowerCatchesUp(t *testing.T) {
+	dropped := errors.New("connection reset by peer")
+	streams := []io.Reader{
+		io.MultiReader(strings.NewReader("2016-06-01T12:00:01.0Z step 1\n2016-06-01T12:00:02.0Z ste"), failingReader{dropped}),
+		strings.NewReader("2016-06-01T12:00:01.0Z step 1\n2016-06-01T12:00:02.0Z step 2\n2016-06-01T12:00:03.0Z done\n"),
+	}
+	var calls []*api.PodLogOptions
+	var buf bytes.Buffer
+	f := &logFollower{
+		out:  &buf,
+		open: fakeLogStreams(streams, &calls),
+		// the container terminated while the first stream was being copied.
+		finished: func() bool { return true },
+		retry:    time.Millisecond,
+		timeout:  time.Minute,
+	}
+	assert.NoErr(t, f.run())
+	assert.Equal(t, buf.String(), "step 1\nstep 2\ndone\n", "logs")
+	assert.Equal(t, len(calls), 2, "number of streams opened")
+	assert.False(t, calls[1].Follow, "expected the last logs not to be followed")
+	if calls[1].SinceTime == nil {
+		t.Errorf("expected the last logs to start at the last line written")
+	}
+}
+
+func TestLogFollowerTimeoutSinceLastLogs(t *testing.T) {
+	// every stream yields a line and then drops, for longer than the timeout altogether.
+	const attempts = 6
+	n := 0
+	var buf bytes.Buffer
+	f := &logFollower{
+		out: &buf,
+		open: func(opts *api.PodLogOptions) (io.ReadCloser, error) {
+			if !opts.Follow {
+				// nothing came after the last line.
+				return ioutil.NopCloser(strings.NewReader("")), nil
+			}
+			n++
+			time.Sleep(5 * time.Millisecond)
+			line := time.Date(2016, 6, 1, 12, 0, n, 0, time.UTC).Format(time.RFC3339Nano) + " line\n"
+			return ioutil.NopCloser(io.MultiReader(strings.NewReader(line), failingReader{errors.New("dropped")})), nil
+		},
+		finished: func() bool { return n == attempts },
+		retry:    time.Millisecond,
+		timeout:  15 * time.Millisecond,
+	}
+	assert.NoErr(t, f.run())
+	assert.Equal(t, buf.String(), strings.Repeat("line\n", attempts), "logs")
+}
+
+func TestSplitLogTimestamp(t *testing.T) {
+	ts, text, ok := splitLogTimestamp("2016-06-01T12:00:00.123456789Z hello world\n")
+	assert.True(t, ok, "expected a timestamp")
+	expected := time.Date(2016, 6, 1, 12, 0, 0, 123456789, time.UTC)
+	assert.True(t, ts.Equal(expected), "expected timestamp %s, got %s", expected, ts)
+	assert.Equal(t, text, "hello world\n", "text")
+
+	for _, line := range []string{"hello world\n", "nospaces\n", ""} {
+		_, text, ok := splitLogTimestamp(line)
+		assert.False(t, ok, "expected no timestamp in %q", line)
+		assert.Equal(t, text, line, "text")
+	}
+}
+
+func TestContainerTerminated(t *testing.T) {
+	pw := &k8s.PodWatcher{}
+	pw.Store.Store = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	finished := containerTerminated(pw, "build")
+	assert.False(t, finished(), "finished without a pod")
+
+	pod := waitingPod("ContainerCreating")
+	assert.NoErr(t, pw.Store.Add(pod))
+	assert.False(t, finished(), "finished while waiting")
+
+	pod.Status.ContainerStatuses[0].State = api.ContainerState{Terminated: &api.ContainerStateTerminated{ExitCode: 0}}
+	assert.NoErr(t, pw.Store.Update(pod))
+	assert.True(t, finished(), "expected a terminated container to be finished")
+}
@@ -0,0 +1,48 @@
+package gitreceive
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/deis/builder/pkg/sys"
+)
+
+const (
+	pushOptionCountEnv = "GIT_PUSH_OPTION_COUNT"
+	pushOptionEnvTpl   = "GIT_PUSH_OPTION_%d"
+
+	// pushOptionColor turns colored output on (color, color=always) or off (color=never).
+	pushOptionColor = "color"
+	// pushOptionRebuild builds the slug even if one was already built from the same tree, and
+	// builds the app even if the push didn't change any of the paths it watches.
+	pushOptionRebuild = "rebuild"
+)
+
+// pushOptions holds the options a client sent with `git push -o <option>`. Options of the form
+// key=value map key to value, and options without a '=' map to the empty string.
+type pushOptions map[string]string
+
+// getPushOptions reads the push options that git exposes to the pre-receive hook in the
+// environment. Git only accepts push options on repositories with receive.advertisePushOptions
+// set, which git.Receive takes care of.
+func getPushOptions(env sys.Env) pushOptions {
+	opts := make(pushOptions)
+	count, err := strconv.Atoi(env.Get(pushOptionCountEnv))
+	if err != nil {
+		return opts
+	}
+	for i := 0; i < count; i++ {
+		opt := env.Get(fmt.Sprintf(pushOptionEnvTpl, i))
+		if opt == "" {
+			continue
+		}
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) == 2 {
+			opts[kv[0]] = kv[1]
+		} else {
+			opts[kv[0]] = ""
+		}
+	}
+	return opts
+}
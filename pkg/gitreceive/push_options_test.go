@@ -0,0 +1,25 @@
+package gitreceive
+
+import (
+	"testing"
+
+	"github.com/arschles/assert"
+	"github.com/deis/builder/pkg/sys"
+)
+
+func TestGetPushOptions(t *testing.T) {
+	env := sys.NewFakeEnv()
+	assert.Equal(t, len(getPushOptions(env)), 0, "number of push options without GIT_PUSH_OPTION_COUNT")
+
+	env.Envs["GIT_PUSH_OPTION_COUNT"] = "3"
+	env.Envs["GIT_PUSH_OPTION_0"] = "color"
+	env.Envs["GIT_PUSH_OPTION_1"] = "path=services/web=v2"
+	env.Envs["GIT_PUSH_OPTION_2"] = ""
+	opts := getPushOptions(env)
+	assert.Equal(t, len(opts), 2, "number of push options")
+	assert.Equal(t, opts["color"], "", "color option")
+	assert.Equal(t, opts["path"], "services/web=v2", "path option")
+
+	env.Envs["GIT_PUSH_OPTION_COUNT"] = "not a number"
+	assert.Equal(t, len(getPushOptions(env)), 0, "number of push options with a malformed count")
+}
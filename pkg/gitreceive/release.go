@@ -0,0 +1,158 @@
+package gitreceive
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/deis/builder/pkg/k8s"
+	deisAPI "github.com/deis/controller-sdk-go/api"
+	"github.com/deis/pkg/log"
+	"github.com/pborman/uuid"
+	"k8s.io/kubernetes/pkg/api"
+	client "k8s.io/kubernetes/pkg/client/unversioned"
+)
+
+const (
+	// releaseProcessType is the process type whose command runs once before every release of the
+	// app, such as database migrations, instead of being a process of the app.
+	releaseProcessType = "release"
+
+	releaseName = "deis-release"
+	slugURL     = "SLUG_URL"
+)
+
+// releaseCommand removes the release command from procType and returns it, or returns "" if
+// procType has none.
+func releaseCommand(procType deisAPI.ProcessType) string {
+	command := strings.TrimSpace(procType[releaseProcessType])
+	delete(procType, releaseProcessType)
+	return command
+}
+
+func releasePodName(appName, shortSha string) string {
+	uid := uuid.New()[:8]
+	// pod names cannot exceed 63 characters in length, so we truncate the application name to stay
+	// under that limit when adding all the extra metadata to the name
+	if len(appName) > 37 {
+		appName = appName[:37]
+	}
+	return fmt.Sprintf("release-%s-%s-%s", appName, shortSha, uid)
+}
+
+// newReleasePod returns the pod that runs the release command of the app appName, built from the
+// commit shortSha. Image builds run it in the image they pushed, image off-cluster and slugName
+// on-cluster, in the app's namespace, which holds the secret that pulls image off-cluster. Slug
+// builds run it in the slug at slugKey in the builder's namespace, which holds the object storage
+// credentials that the slug runner fetches the slug with, like the builder pods do.
+func newReleasePod(
+	conf *Config,
+	appName,
+	shortSha string,
+	env map[string]interface{},
+	command,
+	image,
+	slugName,
+	slugKey string,
+	bType buildType,
+	nodeSelector map[string]string,
+) (*api.Pod, error) {
+
+	name := releasePodName(appName, shortSha)
+	if bType.buildsImage() {
+		pullSecret := ""
+		if conf.RegistryLocation == "on-cluster" {
+			// nodes pull the images of the on-cluster registry through the registry proxy.
+			image = fmt.Sprintf("127.0.0.1:%s/%s", conf.RegistryProxyPort, slugName)
+		} else {
+			pullSecret = conf.RegistrySecretPrefix + "-" + conf.RegistryLocation
+		}
+		// images are tagged with the commit they're built from, so a node never has a stale one.
+		return releaseImagePod(conf.Debug, name, appName, env, command, image, pullSecret, api.PullIfNotPresent, nodeSelector), nil
+	}
+
+	if conf.SlugRunnerImage == "" {
+		return nil, fmt.Errorf("the app has a %s command, but SLUGRUNNER_IMAGE_NAME isn't set, so it can't run", releaseProcessType)
+	}
+	pullPolicy, err := k8s.PullPolicyFromString(conf.SlugRunnerImagePullPolicy)
+	if err != nil {
+		return nil, err
+	}
+	return releaseSlugPod(conf.Debug, name, conf.PodNamespace, env, command, slugKey, conf.StorageType, conf.SlugRunnerImage, pullPolicy, nodeSelector), nil
+}
+
+// releaseImagePod returns a pod that runs command in the image built for the app, with the app
+// config values env as its environment. pullSecret, if set, is the secret that pulls image from
+// an off-cluster registry.
+func releaseImagePod(
+	debug bool,
+	name,
+	namespace string,
+	env map[string]interface{},
+	command,
+	image,
+	pullSecret string,
+	pullPolicy api.PullPolicy,
+	nodeSelector map[string]string,
+) *api.Pod {
+
+	pod := buildPod(debug, name, namespace, pullPolicy, nodeSelector, env)
+	// the image has no use for the object storage credentials, which only the builder's namespace
+	// is sure to hold.
+	pod.Spec.Volumes = nil
+	pod.Spec.Containers[0].VolumeMounts = nil
+
+	pod.Spec.Containers[0].Name = releaseName
+	pod.Spec.Containers[0].Image = image
+	pod.Spec.Containers[0].Command = []string{"/bin/sh", "-c", command}
+	if pullSecret != "" {
+		pod.Spec.ImagePullSecrets = []api.LocalObjectReference{{Name: pullSecret}}
+	}
+	return &pod
+}
+
+// releaseSlugPod returns a pod that runs command in the slug at slugKey, with image, the slug
+// runner, and the app config values env as its environment. The slug runner fetches the slug with
+// the object storage credentials, so namespace has to hold them.
+func releaseSlugPod(
+	debug bool,
+	name,
+	namespace string,
+	env map[string]interface{},
+	command,
+	slugKey,
+	storageType,
+	image string,
+	pullPolicy api.PullPolicy,
+	nodeSelector map[string]string,
+) *api.Pod {
+
+	pod := buildPod(debug, name, namespace, pullPolicy, nodeSelector, env)
+
+	pod.Spec.Containers[0].Name = releaseName
+	pod.Spec.Containers[0].Image = image
+	pod.Spec.Containers[0].Args = []string{"/bin/bash", "-c", command}
+
+	addEnvToPod(pod, slugURL, slugKey)
+	addEnvToPod(pod, builderStorage, storageType)
+
+	return &pod
+}
+
+// runReleasePod runs pod to completion, streaming its logs to out, and deletes it. It returns an
+// error if the pod couldn't run or the release command failed, which aborts the release.
+func runReleasePod(out *progressWriter, conf *Config, kubeClient *client.Client, pod *api.Pod) error {
+	out.begin(phaseReleaseCommand)
+	defer func() {
+		if err := kubeClient.Pods(pod.Namespace).Delete(pod.Name, nil); err != nil {
+			log.Info("unable to delete release pod %s (%s)", pod.Name, err)
+		}
+	}()
+	err := runPod(out, conf, kubeClient, pod, "")
+	if exitErr, ok := err.(podExitError); ok {
+		if !exitErr.terminated {
+			return fmt.Errorf("Release command did not terminate, aborting the release.")
+		}
+		return fmt.Errorf("Release command exited with code %d, aborting the release.", exitErr.code)
+	}
+	return err
+}
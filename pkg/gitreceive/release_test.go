@@ -0,0 +1,75 @@
+package gitreceive
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/arschles/assert"
+	deisAPI "github.com/deis/controller-sdk-go/api"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestReleaseCommand(t *testing.T) {
+	procType := deisAPI.ProcessType{"web": "./server", "release": " ./migrate "}
+	assert.Equal(t, releaseCommand(procType), "./migrate", "release command")
+	if _, ok := procType["release"]; ok {
+		t.Errorf("expected the release command to be removed from the process types")
+	}
+	assert.Equal(t, procType["web"], "./server", "web command")
+
+	assert.Equal(t, releaseCommand(deisAPI.ProcessType{"web": "./server"}), "", "release command")
+	assert.Equal(t, releaseCommand(nil), "", "release command")
+}
+
+func TestReleasePodName(t *testing.T) {
+	name := releasePodName("this-name-has-more-than-24-characters-in-length-and-then-some", "12345678")
+	if !strings.HasPrefix(name, "release-this-name-has-more-than-24-characters-12345678-") {
+		t.Errorf("expected pod name release-this-name-has-more-than-24-characters-12345678-*, got %s", name)
+	}
+	if len(name) > 63 {
+		t.Errorf("expected release pod name length to be <= 63 characters in length, got %d", len(name))
+	}
+}
+
+func TestNewReleasePodImage(t *testing.T) {
+	conf := &Config{RegistryLocation: "on-cluster", RegistryProxyPort: "5555", RegistrySecretPrefix: "private-registry"}
+	env := map[string]interface{}{"DATABASE_URL": "postgres://db"}
+	pod, err := newReleasePod(conf, "myapp", "deadbeef", env, "./migrate", "myapp", "myapp:git-deadbeef", "", buildTypeDockerfile, nil)
+	assert.NoErr(t, err)
+	assert.Equal(t, pod.Namespace, "myapp", "namespace")
+	assert.Equal(t, pod.Spec.Containers[0].Image, "127.0.0.1:5555/myapp:git-deadbeef", "image")
+	assert.Equal(t, strings.Join(pod.Spec.Containers[0].Command, " "), "/bin/sh -c ./migrate", "command")
+	assert.Equal(t, len(pod.Spec.Volumes), 0, "number of volumes")
+	assert.Equal(t, pod.Spec.Containers[0].ImagePullPolicy, api.PullIfNotPresent, "pull policy")
+	assert.Equal(t, len(pod.Spec.ImagePullSecrets), 0, "number of image pull secrets")
+	checkForEnv(t, pod, "DATABASE_URL", "postgres://db")
+
+	conf.RegistryLocation = "gcr"
+	pod, err = newReleasePod(conf, "myapp", "deadbeef", env, "./migrate", "gcr.io/proj/myapp:git-deadbeef", "myapp:git-deadbeef", "", buildTypeCNB, nil)
+	assert.NoErr(t, err)
+	assert.Equal(t, pod.Spec.Containers[0].Image, "gcr.io/proj/myapp:git-deadbeef", "image")
+	assert.Equal(t, len(pod.Spec.ImagePullSecrets), 1, "number of image pull secrets")
+	assert.Equal(t, pod.Spec.ImagePullSecrets[0].Name, "private-registry-gcr", "image pull secret")
+}
+
+func TestNewReleasePodSlug(t *testing.T) {
+	conf := &Config{PodNamespace: "deis", StorageType: "minio", SlugRunnerImagePullPolicy: "IfNotPresent"}
+	env := map[string]interface{}{"DATABASE_URL": "postgres://db"}
+	if _, err := newReleasePod(conf, "myapp", "deadbeef", env, "./migrate", "myapp", "myapp:git-deadbeef", "home/myapp:git-deadbeef/push/slug.tgz", buildTypeProcfile, nil); err == nil {
+		t.Errorf("expected an error without a slug runner image")
+	}
+
+	conf.SlugRunnerImage = "slugrunner"
+	pod, err := newReleasePod(conf, "myapp", "deadbeef", env, "./migrate", "myapp", "myapp:git-deadbeef", "home/myapp:git-deadbeef/push/slug.tgz", buildTypeProcfile, nil)
+	assert.NoErr(t, err)
+	assert.Equal(t, pod.Namespace, "deis", "namespace")
+	assert.Equal(t, len(pod.Spec.Volumes), 1, "number of volumes")
+	assert.Equal(t, pod.Spec.Volumes[0].Secret.SecretName, "objectstorage-keyfile", "object storage secret")
+	assert.Equal(t, pod.Spec.Containers[0].VolumeMounts[0].MountPath, "/var/run/secrets/deis/objectstore/creds", "object storage mount path")
+	assert.Equal(t, pod.Spec.Containers[0].Image, "slugrunner", "image")
+	assert.Equal(t, pod.Spec.Containers[0].ImagePullPolicy, api.PullIfNotPresent, "pull policy")
+	assert.Equal(t, strings.Join(pod.Spec.Containers[0].Args, " "), "/bin/bash -c ./migrate", "args")
+	checkForEnv(t, pod, "SLUG_URL", "home/myapp:git-deadbeef/push/slug.tgz")
+	checkForEnv(t, pod, "BUILDER_STORAGE", "minio")
+	checkForEnv(t, pod, "DATABASE_URL", "postgres://db")
+}
@@ -10,6 +10,12 @@ const (
 	CacheKeyPattern = "home/%s/cache"
 	// GitKeyPattern is the template for storing git key files.
 	GitKeyPattern = "home/%s:git-%s"
+	// TreeKeyPattern is the template for storing files that only depend on the contents of a git
+	// tree, so that they're shared by every commit with that tree.
+	TreeKeyPattern = "home/%s:tree-%s"
+	// UsedMarkerName is the object that a push refreshes under a tree or build prefix whose files
+	// it reuses, so that the cleaner dates the prefix by its last use rather than its upload.
+	UsedMarkerName = "used"
 )
 
 // SlugBuilderInfo contains all of the object storage related information needed to pass to a
@@ -17,14 +23,18 @@ const (
 type SlugBuilderInfo struct {
 	pushKey        string
 	tarKey         string
+	builtSlugKey   string
+	treeUsedKey    string
 	cacheKey       string
 	disableCaching bool
 }
 
-// NewSlugBuilderInfo creates and populates a new SlugBuilderInfo based on the given data
-func NewSlugBuilderInfo(appName string, shortSha string, disableCaching bool) *SlugBuilderInfo {
+// NewSlugBuilderInfo creates and populates a new SlugBuilderInfo based on the given data. The
+// source tarball is keyed by treeHash, so pushes of the same tree share it.
+func NewSlugBuilderInfo(appName string, shortSha string, treeHash string, disableCaching bool) *SlugBuilderInfo {
 	basePath := fmt.Sprintf(GitKeyPattern, appName, shortSha)
-	tarKey := fmt.Sprintf("%s/tar", basePath)
+	treePath := fmt.Sprintf(TreeKeyPattern, appName, treeHash)
+	tarKey := fmt.Sprintf("%s/tar", treePath)
 	// this is where workflow tells slugrunner to download the slug from, so we have to tell slugbuilder to upload it to here
 	pushKey := fmt.Sprintf("%s/push", basePath)
 
@@ -33,6 +43,8 @@ func NewSlugBuilderInfo(appName string, shortSha string, disableCaching bool) *S
 	return &SlugBuilderInfo{
 		pushKey:        pushKey,
 		tarKey:         tarKey,
+		builtSlugKey:   fmt.Sprintf("%s/slug", treePath),
+		treeUsedKey:    usedKey(treePath),
 		cacheKey:       cacheKey,
 		disableCaching: disableCaching,
 	}
@@ -47,6 +59,15 @@ func (s SlugBuilderInfo) PushKey() string { return s.pushKey }
 // folder, not including the final filename.
 func (s SlugBuilderInfo) TarKey() string { return s.tarKey }
 
+// BuiltSlugKey returns the object storage key that records the slug last built from the tree.
+func (s SlugBuilderInfo) BuiltSlugKey() string { return s.builtSlugKey }
+
+// TreeUsedKey returns the object storage key of the marker of the last push that used the tree.
+func (s SlugBuilderInfo) TreeUsedKey() string { return s.treeUsedKey }
+
+// TarChecksumKey returns the object storage key of the SHA-256 checksum of the tarball at TarKey.
+func (s SlugBuilderInfo) TarChecksumKey() string { return checksumKey(s.tarKey) }
+
 // CacheKey returns the object storage key that the slug builder will use to store the cache in
 // it's application specific and persisted between deploys (doesn't contain git-sha)
 func (s SlugBuilderInfo) CacheKey() string { return s.cacheKey }
@@ -55,7 +76,13 @@ func (s SlugBuilderInfo) CacheKey() string { return s.cacheKey }
 func (s SlugBuilderInfo) DisableCaching() bool { return s.disableCaching }
 
 // AbsoluteSlugObjectKey returns the PushKey plus the final filename of the slug.
-func (s SlugBuilderInfo) AbsoluteSlugObjectKey() string { return s.PushKey() + "/" + slugTGZName }
+func (s SlugBuilderInfo) AbsoluteSlugObjectKey() string { return slugKey(s.PushKey()) }
 
 // AbsoluteProcfileKey returns the PushKey plus the standard procfile name.
-func (s SlugBuilderInfo) AbsoluteProcfileKey() string { return s.PushKey() + "/Procfile" }
+func (s SlugBuilderInfo) AbsoluteProcfileKey() string { return procfileKey(s.PushKey()) }
+
+func slugKey(pushKey string) string { return pushKey + "/" + slugTGZName }
+
+func procfileKey(pushKey string) string { return pushKey + "/Procfile" }
+
+func usedKey(prefix string) string { return prefix + "/" + UsedMarkerName }
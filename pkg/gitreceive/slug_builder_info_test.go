@@ -7,11 +7,14 @@ import (
 )
 
 func TestSlugBuilderInfo(t *testing.T) {
-	sbi := NewSlugBuilderInfo("myapp", "c3b4e4ba", false)
+	sbi := NewSlugBuilderInfo("myapp", "c3b4e4ba", "4b825dc642cb6eb9a060e54bf8d69288fbee4904", false)
 	assert.Equal(t, "home/myapp:git-c3b4e4ba/push", sbi.PushKey(), "key")
-	assert.Equal(t, "home/myapp:git-c3b4e4ba/tar", sbi.TarKey(), "key")
+	assert.Equal(t, "home/myapp:tree-4b825dc642cb6eb9a060e54bf8d69288fbee4904/tar", sbi.TarKey(), "key")
+	assert.Equal(t, "home/myapp:tree-4b825dc642cb6eb9a060e54bf8d69288fbee4904/slug", sbi.BuiltSlugKey(), "key")
+	assert.Equal(t, "home/myapp:tree-4b825dc642cb6eb9a060e54bf8d69288fbee4904/used", sbi.TreeUsedKey(), "key")
 	assert.Equal(t, "home/myapp/cache", sbi.CacheKey(), "key")
 	assert.Equal(t, "home/myapp:git-c3b4e4ba/push/slug.tgz", sbi.AbsoluteSlugObjectKey(), "key")
 	assert.Equal(t, "home/myapp:git-c3b4e4ba/push/Procfile", sbi.AbsoluteProcfileKey(), "key")
+	assert.Equal(t, "home/myapp:tree-4b825dc642cb6eb9a060e54bf8d69288fbee4904/tar.sha256", sbi.TarChecksumKey(), "key")
 	assert.Equal(t, false, sbi.DisableCaching(), "key")
 }
@@ -0,0 +1,87 @@
+package gitreceive
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+const (
+	// sourceDirKey is the app config key of the directory of the repository that the app builds
+	// from, for repositories that hold several apps.
+	sourceDirKey = "DEIS_SOURCE_DIR"
+	// dockerfileKey is the app config key of the path of the Dockerfile, relative to the source
+	// directory.
+	dockerfileKey = "DEIS_DOCKERFILE"
+
+	// pushOptionSourceDir overrides the source directory in the app config for a single push.
+	pushOptionSourceDir = "source-dir"
+	// pushOptionDockerfile overrides the Dockerfile path in the app config for a single push.
+	pushOptionDockerfile = "dockerfile"
+
+	defaultDockerfile = "Dockerfile"
+)
+
+// buildSource is the part of a repository that an app builds from.
+type buildSource struct {
+	// dir is the directory of the repository that the source tarball holds, and the build context.
+	// It's empty for the root of the repository.
+	dir string
+	// dockerfile is the path of the Dockerfile, relative to dir.
+	dockerfile string
+}
+
+// getBuildSource returns the source that the app config values and push options opts set, the
+// push options taking precedence.
+func getBuildSource(values map[string]interface{}, opts pushOptions) (buildSource, error) {
+	src := buildSource{dockerfile: defaultDockerfile}
+	dir, err := sourcePath(values, opts, sourceDirKey, pushOptionSourceDir)
+	if err != nil {
+		return src, err
+	}
+	if dir != "." {
+		src.dir = dir
+	}
+	dockerfile, err := sourcePath(values, opts, dockerfileKey, pushOptionDockerfile)
+	if err != nil {
+		return src, err
+	}
+	if dockerfile != "." {
+		src.dockerfile = dockerfile
+	}
+	return src, nil
+}
+
+// sourcePath returns the cleaned path at configKey in values, or at option in opts if it's set
+// there, or "." if neither sets it. Paths must stay inside the directory they're relative to.
+func sourcePath(values map[string]interface{}, opts pushOptions, configKey, option string) (string, error) {
+	raw := ""
+	if val, ok := values[configKey]; ok {
+		raw = fmt.Sprintf("%v", val)
+	}
+	if val, ok := opts[option]; ok {
+		raw = val
+	}
+	p := path.Clean(strings.TrimSpace(raw))
+	if path.IsAbs(p) || p == ".." || strings.HasPrefix(p, "../") {
+		return "", fmt.Errorf("%s %s must be a path inside the repository", configKey, raw)
+	}
+	return p, nil
+}
+
+// treeish returns the git tree-ish of the source at rev, which git archive and git rev-parse
+// take to limit themselves to the source directory.
+func (s buildSource) treeish(rev string) string {
+	if s.dir == "" {
+		return rev
+	}
+	return rev + ":" + s.dir
+}
+
+// describe returns what the source is, for the build output.
+func (s buildSource) describe() string {
+	if s.dir == "" {
+		return "the repository root"
+	}
+	return s.dir
+}
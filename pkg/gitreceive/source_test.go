@@ -0,0 +1,81 @@
+package gitreceive
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/arschles/assert"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestGetBuildSource(t *testing.T) {
+	src, err := getBuildSource(map[string]interface{}{}, pushOptions{})
+	assert.NoErr(t, err)
+	assert.Equal(t, src, buildSource{dockerfile: "Dockerfile"}, "default source")
+
+	values := map[string]interface{}{"DEIS_SOURCE_DIR": "services/api/", "DEIS_DOCKERFILE": "docker/Dockerfile"}
+	src, err = getBuildSource(values, pushOptions{})
+	assert.NoErr(t, err)
+	assert.Equal(t, src, buildSource{dir: "services/api", dockerfile: "docker/Dockerfile"}, "configured source")
+
+	src, err = getBuildSource(values, pushOptions{"source-dir": "services/web", "dockerfile": "Dockerfile.dev"})
+	assert.NoErr(t, err)
+	assert.Equal(t, src, buildSource{dir: "services/web", dockerfile: "Dockerfile.dev"}, "source set by push options")
+
+	src, err = getBuildSource(values, pushOptions{"source-dir": "."})
+	assert.NoErr(t, err)
+	assert.Equal(t, src.dir, "", "source dir set to the root by a push option")
+
+	for _, dir := range []string{"/etc", "..", "../other", "services/../../other"} {
+		if _, err := getBuildSource(map[string]interface{}{"DEIS_SOURCE_DIR": dir}, pushOptions{}); err == nil {
+			t.Errorf("expected an error for source dir %s", dir)
+		}
+	}
+	if _, err := getBuildSource(map[string]interface{}{}, pushOptions{"dockerfile": "../Dockerfile"}); err == nil {
+		t.Errorf("expected an error for a Dockerfile outside the source dir")
+	}
+}
+
+func TestBuildSourceTreeish(t *testing.T) {
+	dir, err := ioutil.TempDir("", "source-treeish")
+	assert.NoErr(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoErr(t, os.MkdirAll(dir+"/services/api", 0755))
+	assert.NoErr(t, ioutil.WriteFile(dir+"/services/api/Procfile", []byte("web: ./api\n"), 0644))
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "first"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("running git %v (%s): %s", args, err, out)
+		}
+	}
+
+	root, err := treeHash(dir, buildSource{}.treeish("HEAD"))
+	assert.NoErr(t, err)
+	sub, err := treeHash(dir, buildSource{dir: "services/api"}.treeish("HEAD"))
+	assert.NoErr(t, err)
+	if root == sub {
+		t.Errorf("expected the tree of services/api to differ from the root tree %s", root)
+	}
+	if _, err := treeHash(dir, buildSource{dir: "services/web"}.treeish("HEAD")); err == nil {
+		t.Errorf("expected an error for a source dir that doesn't exist")
+	}
+}
+
+func TestAddSourceToPod(t *testing.T) {
+	pod := &api.Pod{Spec: api.PodSpec{Containers: []api.Container{{}}}}
+	addSourceToPod(pod, buildSource{dir: "services/api", dockerfile: "Dockerfile.prod"}, buildTypeDockerfile)
+	checkForEnv(t, pod, "SOURCE_DIR", "services/api")
+	checkForEnv(t, pod, "DOCKERFILE", "Dockerfile.prod")
+
+	pod = &api.Pod{Spec: api.PodSpec{Containers: []api.Container{{}}}}
+	addSourceToPod(pod, buildSource{dockerfile: "Dockerfile"}, buildTypeProcfile)
+	assert.Equal(t, len(pod.Spec.Containers[0].Env), 0, "number of env vars for a buildpack build from the root")
+}
@@ -0,0 +1,271 @@
+package gitreceive
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	deisAPI "github.com/deis/controller-sdk-go/api"
+	"gopkg.in/yaml.v2"
+)
+
+// procfileLine matches the lines of a Procfile that define a process type.
+var procfileLine = regexp.MustCompile(`^([^\s:#]+):(.*)$`)
+
+// dockerfileDirective matches the parser directives at the top of a Dockerfile, such as
+// # escape=`.
+var dockerfileDirective = regexp.MustCompile(`^#\s*([A-Za-z][A-Za-z0-9]*)\s*=\s*(\S+)\s*$`)
+
+// dockerfileHeredocStart matches the start of a heredoc in a Dockerfile instruction, such as
+// <<EOF, <<-EOF or <<"EOF".
+var dockerfileHeredocStart = regexp.MustCompile(`<<(-?)(["']?)([A-Za-z_][A-Za-z0-9_]*)["']?`)
+
+// dockerfileInstructions are the instructions a Dockerfile may hold.
+var dockerfileInstructions = map[string]bool{
+	"ADD": true, "ARG": true, "CMD": true, "COPY": true, "ENTRYPOINT": true, "ENV": true,
+	"EXPOSE": true, "FROM": true, "HEALTHCHECK": true, "LABEL": true, "MAINTAINER": true,
+	"ONBUILD": true, "RUN": true, "SHELL": true, "STOPSIGNAL": true, "USER": true, "VOLUME": true,
+	"WORKDIR": true,
+}
+
+// sourceProblems are the problems found in the source of an app before building it. Errors stop
+// the build, warnings are only reported.
+type sourceProblems struct {
+	errors   []string
+	warnings []string
+}
+
+func (p *sourceProblems) errorf(format string, args ...interface{}) {
+	p.errors = append(p.errors, fmt.Sprintf(format, args...))
+}
+
+func (p *sourceProblems) warnf(format string, args ...interface{}) {
+	p.warnings = append(p.warnings, fmt.Sprintf(format, args...))
+}
+
+// err returns an error listing every error, or nil if there are none.
+func (p sourceProblems) err() error {
+	if len(p.errors) == 0 {
+		return nil
+	}
+	return fmt.Errorf("the source has %d problem(s), fix them and push again:\n%s", len(p.errors), strings.Join(p.errors, "\n"))
+}
+
+// validateSource checks the Procfile and, for Dockerfile builds, the Dockerfile at the path
+// dockerfile of the source extracted to dir, so that mistakes in them fail the push before a build
+// pod starts instead of after it ends. The process types in the manifest m, if any, count along
+// with those of the Procfile; validateManifest checks the rest of m.
+func validateSource(dir, dockerfile string, bType buildType, m *manifest) (sourceProblems, error) {
+	var problems sourceProblems
+	var procfile deisAPI.ProcessType
+	rawProcfile, err := ioutil.ReadFile(filepath.Join(dir, "Procfile"))
+	switch {
+	case err == nil:
+		procfile = validateProcfile(&problems, rawProcfile)
+	case os.IsNotExist(err):
+		for _, name := range []string{"procfile", "Procfile.txt", "Procfile.yml", "Procfile.yaml"} {
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				problems.warnf("found %s, but only a file named Procfile defines process types", name)
+			}
+		}
+	default:
+		return problems, fmt.Errorf("reading the Procfile (%s)", err)
+	}
+
+	if m != nil {
+		for _, name := range sortedKeys(m.Processes) {
+			if _, ok := procfile[name]; ok {
+				problems.warnf("process type %s is defined in both the Procfile and %s, so the Procfile's command is used", name, manifestName)
+			}
+		}
+		if bType == buildTypeProcfile && len(m.Build.Buildpacks) > 1 {
+			problems.warnf("%s lists %d buildpacks, but slug builds only use the first one, %s", manifestName, len(m.Build.Buildpacks), m.Build.Buildpacks[0])
+		}
+	}
+	processes := m.processTypes(procfile, procfile != nil)
+	if _, ok := processes["web"]; !ok && len(processes) > 0 {
+		problems.warnf("there's no web process type, so the app only gets HTTP traffic if the build provides one")
+	}
+
+	if bType != buildTypeDockerfile {
+		return problems, nil
+	}
+	rawDockerfile, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(dockerfile)))
+	if os.IsNotExist(err) {
+		problems.errorf("%s: no such file in the source", dockerfile)
+		return problems, nil
+	} else if err != nil {
+		return problems, fmt.Errorf("reading %s (%s)", dockerfile, err)
+	}
+	validateDockerfile(&problems, dockerfile, rawDockerfile, len(processes) > 0)
+	return problems, nil
+}
+
+// procfileDef is a line of a Procfile that defines a process type.
+type procfileDef struct {
+	num  int
+	line string
+}
+
+// validateProcfile adds the problems in the Procfile data to problems, and returns the process
+// types it defines.
+func validateProcfile(problems *sourceProblems, data []byte) deisAPI.ProcessType {
+	// lines maps every process type to the number of the line that defines it.
+	lines := map[string]int{}
+	var defs []procfileDef
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	num := 1
+	for ; scanner.Scan(); num++ {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		// indented lines continue the command of the line before them, which YAML checks below.
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || line != strings.TrimLeft(line, " \t") {
+			continue
+		}
+		match := procfileLine.FindStringSubmatch(line)
+		if match == nil {
+			problems.errorf("Procfile line %d: expected <process type>: <command>, got %q", num, line)
+			continue
+		}
+		name := match[1]
+		if first, ok := lines[name]; ok {
+			problems.errorf("Procfile line %d: process type %s is already defined on line %d", num, name, first)
+			continue
+		}
+		lines[name] = num
+		defs = append(defs, procfileDef{num: num, line: line})
+		if name != strings.ToLower(name) {
+			problems.warnf("Procfile line %d: process type %s isn't lowercase, so it's a different process type than %s", num, name, strings.ToLower(name))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		problems.errorf("Procfile line %d can't be read (%s)", num, err)
+	}
+	if len(problems.errors) > 0 {
+		return nil
+	}
+
+	procType := deisAPI.ProcessType{}
+	if err := yaml.Unmarshal(data, &procType); err != nil {
+		// YAML doesn't always say where the error is, but it's usually in a single line.
+		for _, def := range defs {
+			if err := yaml.Unmarshal([]byte(def.line), &deisAPI.ProcessType{}); err != nil {
+				problems.errorf("Procfile line %d is malformed (%s)", def.num, err)
+				return nil
+			}
+		}
+		problems.errorf("Procfile is malformed (%s)", err)
+		return nil
+	}
+	for name, command := range procType {
+		if strings.TrimSpace(command) == "" {
+			problems.errorf("Procfile line %d: process type %s has no command", lines[name], name)
+		}
+	}
+	return procType
+}
+
+// validateDockerfile adds the problems in the Dockerfile data, at the path name, to problems.
+// Without a CMD or ENTRYPOINT, the image may still run something, from its base image or from
+// the process types of a Procfile, so that's only a warning. So are instructions it doesn't know,
+// since the builder may know newer ones: the builder has the final say on those.
+func validateDockerfile(problems *sourceProblems, name string, data []byte, hasProcfile bool) {
+	seen := map[string]bool{}
+	escape := `\`
+	directives := true
+	// heredocs are the delimiters of the heredocs that the lines to come are the bodies of.
+	var heredocs []dockerfileHeredoc
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	num := 1
+	for continued := false; scanner.Scan(); num++ {
+		raw := scanner.Text()
+		// the bodies of heredocs start after the instruction that starts them ends.
+		if len(heredocs) > 0 && !continued {
+			if heredocs[0].ends(raw) {
+				heredocs = heredocs[1:]
+			}
+			continue
+		}
+		line := strings.TrimSpace(raw)
+		if directives {
+			// parser directives, such as escape, are only read before anything else.
+			if match := dockerfileDirective.FindStringSubmatch(line); match != nil {
+				if strings.ToLower(match[1]) == "escape" && (match[2] == "`" || match[2] == `\`) {
+					escape = match[2]
+				}
+				continue
+			}
+			directives = false
+		}
+		wasContinued := continued
+		if line == "" || strings.HasPrefix(line, "#") {
+			// comments and blank lines don't end a continued instruction.
+			continue
+		}
+		continued = strings.HasSuffix(line, escape)
+		if wasContinued {
+			heredocs = append(heredocs, findHeredocs(line)...)
+			continue
+		}
+		instruction := strings.ToUpper(strings.Fields(line)[0])
+		if !dockerfileInstructions[instruction] {
+			problems.warnf("%s line %d: unknown instruction %s", name, num, strings.Fields(line)[0])
+			continue
+		}
+		if instruction == "RUN" || instruction == "COPY" || instruction == "ADD" {
+			heredocs = append(heredocs, findHeredocs(line)...)
+		}
+		if !seen["FROM"] && instruction != "FROM" && instruction != "ARG" {
+			problems.errorf("%s line %d: %s comes before the first FROM instruction", name, num, instruction)
+		}
+		seen[instruction] = true
+	}
+	if err := scanner.Err(); err != nil {
+		problems.warnf("%s line %d can't be read (%s), so the rest of it isn't checked", name, num, err)
+		return
+	}
+
+	if !seen["FROM"] {
+		problems.errorf("%s has no FROM instruction", name)
+	}
+	if !seen["EXPOSE"] {
+		problems.warnf("%s has no EXPOSE instruction, so the router can't tell which port the app listens on unless the app config sets PORT", name)
+	}
+	if !seen["CMD"] && !seen["ENTRYPOINT"] && !hasProcfile {
+		problems.warnf("%s has no CMD or ENTRYPOINT instruction, and there's no Procfile, so the app runs whatever its base image runs", name)
+	}
+}
+
+// dockerfileHeredoc is a heredoc of a Dockerfile instruction, such as RUN <<EOF.
+type dockerfileHeredoc struct {
+	delimiter string
+	// stripTabs is true for <<-EOF heredocs, whose lines may be indented with tabs.
+	stripTabs bool
+}
+
+// ends returns true if line is the last one of the heredoc h.
+func (h dockerfileHeredoc) ends(line string) bool {
+	if h.stripTabs {
+		line = strings.TrimLeft(line, "\t")
+	}
+	return line == h.delimiter
+}
+
+// findHeredocs returns the heredocs that the instruction line starts, in order. The exec form of
+// instructions has none.
+func findHeredocs(line string) []dockerfileHeredoc {
+	fields := strings.Fields(line)
+	if len(fields) > 1 && strings.HasPrefix(fields[1], "[") {
+		return nil
+	}
+	var heredocs []dockerfileHeredoc
+	for _, match := range dockerfileHeredocStart.FindAllStringSubmatch(line, -1) {
+		heredocs = append(heredocs, dockerfileHeredoc{delimiter: match[3], stripTabs: match[1] == "-"})
+	}
+	return heredocs
+}
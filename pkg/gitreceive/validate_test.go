@@ -0,0 +1,174 @@
+package gitreceive
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/arschles/assert"
+)
+
+func TestValidateProcfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		procfile string
+		errors   []string
+		warnings []string
+	}{
+		{
+			name:     "valid",
+			procfile: "# processes\nweb: ./server -port $PORT\n\nworker: ./worker\n",
+		},
+		{
+			name:     "continued command",
+			procfile: "web: >\n  ./server\n  -port $PORT\n",
+		},
+		{
+			name:     "duplicate process type",
+			procfile: "web: ./server\nworker: ./worker\nweb: ./other\n",
+			errors:   []string{"Procfile line 3: process type web is already defined on line 1"},
+		},
+		{
+			name:     "empty command",
+			procfile: "web: ./server\nworker:\n",
+			errors:   []string{"Procfile line 2: process type worker has no command"},
+		},
+		{
+			name:     "not a process type",
+			procfile: "web: ./server\n./worker\n",
+			errors:   []string{`Procfile line 2: expected <process type>: <command>, got "./worker"`},
+		},
+		{
+			name:     "malformed YAML",
+			procfile: "web: ./server\nworker: ./worker --opt: value\n",
+			errors:   []string{"Procfile line 2 is malformed (yaml: mapping values are not allowed in this context)"},
+		},
+		{
+			name:     "line too long",
+			procfile: "web: ./server\nworker: " + strings.Repeat("x", bufio.MaxScanTokenSize) + "\n",
+			errors:   []string{"Procfile line 2 can't be read (bufio.Scanner: token too long)"},
+		},
+		{
+			name:     "not lowercase",
+			procfile: "Worker: ./worker\n",
+			warnings: []string{"Procfile line 1: process type Worker isn't lowercase, so it's a different process type than worker"},
+		},
+	}
+	for _, test := range tests {
+		var problems sourceProblems
+		validateProcfile(&problems, []byte(test.procfile))
+		assert.Equal(t, strings.Join(problems.errors, "\n"), strings.Join(test.errors, "\n"), test.name+" errors")
+		assert.Equal(t, strings.Join(problems.warnings, "\n"), strings.Join(test.warnings, "\n"), test.name+" warnings")
+	}
+}
+
+func TestValidateDockerfile(t *testing.T) {
+	tests := []struct {
+		name        string
+		dockerfile  string
+		hasProcfile bool
+		errors      []string
+		warnings    []string
+	}{
+		{
+			name:       "valid",
+			dockerfile: "ARG VERSION=1\nFROM alpine:$VERSION\n# install\nRUN apk add --no-cache \\\n  curl \\\n\n  git\nEXPOSE 5000\nCMD [\"./server\"]\n",
+		},
+		{
+			name:        "no EXPOSE or CMD",
+			dockerfile:  "FROM alpine\n",
+			hasProcfile: false,
+			warnings: []string{
+				"Dockerfile has no EXPOSE instruction, so the router can't tell which port the app listens on unless the app config sets PORT",
+				"Dockerfile has no CMD or ENTRYPOINT instruction, and there's no Procfile, so the app runs whatever its base image runs",
+			},
+		},
+		{
+			name:        "no CMD with a Procfile",
+			dockerfile:  "FROM alpine\nEXPOSE 5000\n",
+			hasProcfile: true,
+		},
+		{
+			name:       "typo",
+			dockerfile: "FROM alpine\nRUNN make\nEXPOSE 5000\nENTRYPOINT [\"./server\"]\n",
+			warnings:   []string{"Dockerfile line 2: unknown instruction RUNN"},
+		},
+		{
+			name:       "heredocs",
+			dockerfile: "FROM alpine\nRUN <<EOF\napk add curl\nset -e\nEOF\nCOPY <<-\"CONF\" <<INIT /etc/\n\tlisten 5000\n\tCONF\n#!/bin/sh\nINIT\nRUN [\"echo\", \"<<EOF\"]\nEXPOSE 5000\nCMD [\"./server\"]\n",
+		},
+		{
+			name:       "heredoc after a continued instruction",
+			dockerfile: "FROM alpine\nRUN python3 \\\n  - <<EOF\nprint('hi')\nEOF\nEXPOSE 5000\nCMD [\"./server\"]\n",
+		},
+		{
+			name:       "escape directive",
+			dockerfile: "# escape=`\nFROM mcr.microsoft.com/windows/servercore\nCOPY . C:\\app\\\nRUN dir `\n  C:\\app\nEXPOSE 5000\nCMD [\"C:\\\\app\\\\server.exe\"]\n",
+		},
+		{
+			name:       "line too long",
+			dockerfile: "FROM alpine\nRUN " + strings.Repeat("x", bufio.MaxScanTokenSize) + "\nCMD ./server\n",
+			warnings:   []string{"Dockerfile line 2 can't be read (bufio.Scanner: token too long), so the rest of it isn't checked"},
+		},
+		{
+			name:       "no FROM",
+			dockerfile: "RUN make\nEXPOSE 5000\nCMD ./server\n",
+			errors: []string{
+				"Dockerfile line 1: RUN comes before the first FROM instruction",
+				"Dockerfile line 2: EXPOSE comes before the first FROM instruction",
+				"Dockerfile line 3: CMD comes before the first FROM instruction",
+				"Dockerfile has no FROM instruction",
+			},
+		},
+	}
+	for _, test := range tests {
+		var problems sourceProblems
+		validateDockerfile(&problems, "Dockerfile", []byte(test.dockerfile), test.hasProcfile)
+		assert.Equal(t, strings.Join(problems.errors, "\n"), strings.Join(test.errors, "\n"), test.name+" errors")
+		assert.Equal(t, strings.Join(problems.warnings, "\n"), strings.Join(test.warnings, "\n"), test.name+" warnings")
+	}
+}
+
+func TestValidateSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "validate-source")
+	assert.NoErr(t, err)
+	defer os.RemoveAll(dir)
+
+	problems, err := validateSource(dir, "Dockerfile", buildTypeProcfile, nil)
+	assert.NoErr(t, err)
+	assert.NoErr(t, problems.err())
+
+	assert.NoErr(t, ioutil.WriteFile(dir+"/procfile", []byte("web: ./server\n"), 0644))
+	problems, err = validateSource(dir, "Dockerfile", buildTypeProcfile, nil)
+	assert.NoErr(t, err)
+	assert.Equal(t, strings.Join(problems.warnings, "\n"), "found procfile, but only a file named Procfile defines process types", "warnings")
+
+	problems, err = validateSource(dir, "docker/Dockerfile", buildTypeDockerfile, nil)
+	assert.NoErr(t, err)
+	assert.Equal(t, strings.Join(problems.errors, "\n"), "docker/Dockerfile: no such file in the source", "errors")
+	assert.ExistsErr(t, problems.err(), "missing Dockerfile")
+
+	assert.NoErr(t, ioutil.WriteFile(dir+"/Procfile", []byte("web: ./server\nworker: ./worker\n"), 0644))
+	assert.NoErr(t, ioutil.WriteFile(dir+"/Dockerfile", []byte("FROM alpine\nEXPOSE 5000\n"), 0644))
+	m := &manifest{
+		Build:     manifestBuild{Buildpacks: []string{"https://example.com/bp1", "https://example.com/bp2"}},
+		Processes: map[string]string{"worker": "./other-worker", "clock": "./clock"},
+	}
+	problems, err = validateSource(dir, "Dockerfile", buildTypeProcfile, m)
+	assert.NoErr(t, err)
+	assert.NoErr(t, problems.err())
+	assert.Equal(t, strings.Join(problems.warnings, "\n"), strings.Join([]string{
+		"process type worker is defined in both the Procfile and deis.yaml, so the Procfile's command is used",
+		"deis.yaml lists 2 buildpacks, but slug builds only use the first one, https://example.com/bp1",
+	}, "\n"), "warnings")
+
+	assert.NoErr(t, os.Remove(dir+"/Procfile"))
+	problems, err = validateSource(dir, "Dockerfile", buildTypeDockerfile, &manifest{Processes: map[string]string{"worker": "./worker"}})
+	assert.NoErr(t, err)
+	assert.Equal(t, strings.Join(problems.warnings, "\n"), strings.Join([]string{
+		"found procfile, but only a file named Procfile defines process types",
+		"there's no web process type, so the app only gets HTTP traffic if the build provides one",
+	}, "\n"), "warnings")
+}
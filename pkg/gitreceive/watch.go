@@ -0,0 +1,80 @@
+package gitreceive
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// watchPathsKey is the app config key of the comma separated globs of the paths in the
+// repository that a push has to change to be built.
+const watchPathsKey = "DEIS_WATCH_PATHS"
+
+// zeroRev is the old revision git reports for a ref that the push creates.
+var zeroRev = strings.Repeat("0", 40)
+
+// getWatchPaths returns the globs of the paths that the app config values watch. If they don't set
+// any, an app that builds from a directory of the repository watches that directory, and other
+// apps watch the whole repository, which is returned as no globs. It returns an error for a
+// malformed glob, which would never match.
+func getWatchPaths(values map[string]interface{}, src buildSource) ([]string, error) {
+	var globs []string
+	if val, ok := values[watchPathsKey]; ok {
+		for _, glob := range strings.Split(fmt.Sprintf("%v", val), ",") {
+			glob = strings.Trim(strings.TrimSpace(glob), "/")
+			if glob == "" {
+				continue
+			}
+			if _, err := path.Match(glob, ""); err != nil {
+				return nil, fmt.Errorf("%s has a malformed glob %s (%s)", watchPathsKey, glob, err)
+			}
+			globs = append(globs, glob)
+		}
+	}
+	if len(globs) == 0 && src.dir != "" {
+		globs = []string{src.dir}
+	}
+	return globs, nil
+}
+
+// changedFiles returns the paths of the files that differ between the commits oldRev and newRev
+// in the repository at repoDir.
+func changedFiles(repoDir, oldRev, newRev string) ([]string, error) {
+	cmd := repoCmd(repoDir, "git", "diff", "--name-only", "--no-renames", oldRev, newRev)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("running %s (%s)", strings.Join(cmd.Args, " "), err)
+	}
+	var files []string
+	for _, file := range strings.Split(string(out), "\n") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// watchedChange returns the first of files that one of globs matches, and false if none does.
+func watchedChange(globs, files []string) (string, bool) {
+	for _, file := range files {
+		for _, glob := range globs {
+			if matchWatchPath(glob, file) {
+				return file, true
+			}
+		}
+	}
+	return "", false
+}
+
+// matchWatchPath returns true if glob, in the syntax of path.Match, matches file or one of the
+// directories it's in. So services/api and services/* both match services/api/main.go. A trailing
+// /** is the same as leaving it out.
+func matchWatchPath(glob, file string) bool {
+	glob = strings.TrimSuffix(glob, "/**")
+	for p := file; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		if ok, err := path.Match(glob, p); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
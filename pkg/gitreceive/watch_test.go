@@ -0,0 +1,92 @@
+package gitreceive
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/arschles/assert"
+)
+
+func TestGetWatchPaths(t *testing.T) {
+	globs, err := getWatchPaths(map[string]interface{}{}, buildSource{})
+	assert.NoErr(t, err)
+	assert.Equal(t, len(globs), 0, "number of globs watched by default")
+
+	globs, err = getWatchPaths(map[string]interface{}{}, buildSource{dir: "services/api"})
+	assert.NoErr(t, err)
+	assert.Equal(t, strings.Join(globs, ","), "services/api", "globs watched by an app with a source dir")
+
+	values := map[string]interface{}{"DEIS_WATCH_PATHS": " services/api/ , libs/*,,"}
+	globs, err = getWatchPaths(values, buildSource{dir: "services/api"})
+	assert.NoErr(t, err)
+	assert.Equal(t, strings.Join(globs, ","), "services/api,libs/*", "configured globs")
+
+	_, err = getWatchPaths(map[string]interface{}{"DEIS_WATCH_PATHS": "services/[api"}, buildSource{})
+	assert.ExistsErr(t, err, "malformed glob")
+}
+
+func TestMatchWatchPath(t *testing.T) {
+	tests := []struct {
+		glob  string
+		file  string
+		match bool
+	}{
+		{"services/api", "services/api/main.go", true},
+		{"services/api/**", "services/api/cmd/main.go", true},
+		{"services/*", "services/web/index.html", true},
+		{"*.go", "main.go", true},
+		{"libs/*/go.mod", "libs/util/go.mod", true},
+		{"services/api", "services/apiserver/main.go", false},
+		{"services/api", "services/web/main.go", false},
+		{"*.go", "services/api/main.go", false},
+	}
+	for _, test := range tests {
+		if match := matchWatchPath(test.glob, test.file); match != test.match {
+			t.Errorf("expected glob %s to match %s %v, got %v", test.glob, test.file, test.match, match)
+		}
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "changed-files")
+	assert.NoErr(t, err)
+	defer os.RemoveAll(dir)
+
+	gitCmd := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("running git %v (%s): %s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	gitCmd("init", "-q")
+	assert.NoErr(t, os.MkdirAll(dir+"/services/api", 0755))
+	assert.NoErr(t, ioutil.WriteFile(dir+"/README.md", []byte("readme\n"), 0644))
+	gitCmd("add", ".")
+	gitCmd("commit", "-q", "-m", "first")
+	first := gitCmd("rev-parse", "HEAD")
+
+	assert.NoErr(t, ioutil.WriteFile(dir+"/services/api/main.go", []byte("package main\n"), 0644))
+	gitCmd("add", ".")
+	gitCmd("commit", "-q", "-m", "second")
+	second := gitCmd("rev-parse", "HEAD")
+
+	files, err := changedFiles(dir, first, second)
+	assert.NoErr(t, err)
+	assert.Equal(t, strings.Join(files, ","), "services/api/main.go", "changed files")
+
+	file, changed := watchedChange([]string{"services/web", "services/api"}, files)
+	assert.True(t, changed, "expected a change to services/api to be watched")
+	assert.Equal(t, file, "services/api/main.go", "watched change")
+	_, changed = watchedChange([]string{"services/web"}, files)
+	assert.False(t, changed, "a change to services/api was watched by services/web")
+
+	if _, err := changedFiles(dir, zeroRev, second); err == nil {
+		t.Errorf("expected an error for a revision that doesn't exist")
+	}
+}
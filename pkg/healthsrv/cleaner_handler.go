@@ -0,0 +1,50 @@
+package healthsrv
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/deis/builder/pkg/cleaner"
+	"github.com/deis/builder/pkg/gitreceive"
+)
+
+// CleanerReporter is a (*github.com/deis/builder/pkg/cleaner).Reports compatible interface that
+// provides the report of the last cleaner run and the buildpack cache stats it last gathered. It
+// can also be implemented for unit tests.
+type CleanerReporter interface {
+	Last() (cleaner.Report, bool)
+	Caches() ([]gitreceive.CacheStats, bool)
+}
+
+// cleanerHandler serves the decisions of the last cleaner run as JSON, or a 404 if the cleaner
+// hasn't finished a run yet.
+func cleanerHandler(reporter CleanerReporter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rep, ok := reporter.Last()
+		if !ok {
+			http.Error(w, "the cleaner hasn't finished a run yet", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(rep); err != nil {
+			log.Printf("Error encoding the cleaner report (%s)", err)
+		}
+	})
+}
+
+// cachesHandler serves the stats of the buildpack caches of all apps as JSON, or a 404 if the
+// cleaner hasn't gathered them yet.
+func cachesHandler(reporter CleanerReporter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caches, ok := reporter.Caches()
+		if !ok {
+			http.Error(w, "the cleaner hasn't gathered the cache stats yet", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(caches); err != nil {
+			log.Printf("Error encoding the cache stats (%s)", err)
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package healthsrv
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arschles/assert"
+	"github.com/deis/builder/pkg/cleaner"
+	"github.com/deis/builder/pkg/gitreceive"
+)
+
+type fakeCleanerReporter struct {
+	rep    *cleaner.Report
+	caches []gitreceive.CacheStats
+}
+
+func (f fakeCleanerReporter) Caches() ([]gitreceive.CacheStats, bool) {
+	return f.caches, f.caches != nil
+}
+
+func (f fakeCleanerReporter) Last() (cleaner.Report, bool) {
+	if f.rep == nil {
+		return cleaner.Report{}, false
+	}
+	return *f.rep, true
+}
+
+func TestCleanerNoReport(t *testing.T) {
+	h := cleanerHandler(fakeCleanerReporter{})
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/cleaner", bytes.NewBuffer(nil))
+	assert.NoErr(t, err)
+	h.ServeHTTP(w, r)
+	assert.Equal(t, w.Code, http.StatusNotFound, "response code")
+}
+
+func TestCleanerReport(t *testing.T) {
+	rep := &cleaner.Report{
+		DryRun: true,
+		Apps:   2,
+		Decisions: []cleaner.Decision{
+			{App: "myapp", Action: cleaner.ActionDeleteApp, Reason: "app not found"},
+		},
+	}
+	h := cleanerHandler(fakeCleanerReporter{rep: rep})
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/cleaner", bytes.NewBuffer(nil))
+	assert.NoErr(t, err)
+	h.ServeHTTP(w, r)
+	assert.Equal(t, w.Code, http.StatusOK, "response code")
+	assert.Equal(t, w.Header().Get("Content-Type"), "application/json", "content type")
+
+	var got cleaner.Report
+	assert.NoErr(t, json.NewDecoder(w.Body).Decode(&got))
+	assert.True(t, got.DryRun, "expected a dry run report")
+	assert.Equal(t, got.Apps, 2, "number of apps")
+	assert.Equal(t, len(got.Decisions), 1, "number of decisions")
+	assert.Equal(t, got.Decisions[0], rep.Decisions[0], "decision")
+}
+
+func TestCaches(t *testing.T) {
+	h := cachesHandler(fakeCleanerReporter{})
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/caches", bytes.NewBuffer(nil))
+	assert.NoErr(t, err)
+	h.ServeHTTP(w, r)
+	assert.Equal(t, w.Code, http.StatusNotFound, "response code")
+
+	caches := []gitreceive.CacheStats{{App: "myapp", Key: "home/myapp/cache", Size: 1024}}
+	h = cachesHandler(fakeCleanerReporter{caches: caches})
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, w.Code, http.StatusOK, "response code")
+	var got []gitreceive.CacheStats
+	assert.NoErr(t, json.NewDecoder(w.Body).Decode(&got))
+	assert.Equal(t, len(got), 1, "number of caches")
+	assert.Equal(t, got[0].Size, int64(1024), "cache size")
+}
@@ -10,7 +10,7 @@ import (
 
 // Start starts the healthcheck server on :$port and blocks. It only returns if the server fails,
 // with the indicative error.
-func Start(cnf *sshd.Config, nsLister NamespaceLister, bLister BucketLister, sshServerCircuit *sshd.Circuit) error {
+func Start(cnf *sshd.Config, nsLister NamespaceLister, bLister BucketLister, sshServerCircuit *sshd.Circuit, cleanerReports CleanerReporter) error {
 	mux := http.NewServeMux()
 	client, err := controller.New(cnf.ControllerHost, cnf.ControllerPort)
 	if err != nil {
@@ -18,6 +18,8 @@ func Start(cnf *sshd.Config, nsLister NamespaceLister, bLister BucketLister, ssh
 	}
 	mux.Handle("/healthz", healthZHandler(bLister, sshServerCircuit))
 	mux.Handle("/readiness", readinessHandler(client, nsLister))
+	mux.Handle("/cleaner", cleanerHandler(cleanerReports))
+	mux.Handle("/caches", cachesHandler(cleanerReports))
 
 	hostStr := fmt.Sprintf(":%d", cnf.HealthSrvPort)
 	return http.ListenAndServe(hostStr, mux)
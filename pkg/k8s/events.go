@@ -0,0 +1,49 @@
+package k8s
+
+import (
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+	client "k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/controller/framework"
+	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/runtime"
+	"k8s.io/kubernetes/pkg/watch"
+)
+
+// NewPodEventWatcher creates a controller that calls handler with every event recorded against the pod ns/podName, including
+// events that are updated in place because they happened again. Run the returned controller to start watching.
+func NewPodEventWatcher(c *client.Client, ns, podName string, handler func(*api.Event)) *framework.Controller {
+	selector := podEventSelector(ns, podName)
+	notify := func(obj interface{}) {
+		if event, ok := obj.(*api.Event); ok {
+			handler(event)
+		}
+	}
+	_, controller := framework.NewInformer(
+		&cache.ListWatch{
+			ListFunc: func(opts api.ListOptions) (runtime.Object, error) {
+				return c.Events(ns).List(api.ListOptions{FieldSelector: selector})
+			},
+			WatchFunc: func(opts api.ListOptions) (watch.Interface, error) {
+				return c.Events(ns).Watch(api.ListOptions{FieldSelector: selector, ResourceVersion: opts.ResourceVersion})
+			},
+		},
+		&api.Event{},
+		resyncPeriod,
+		framework.ResourceEventHandlerFuncs{
+			AddFunc: notify,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				notify(newObj)
+			},
+		},
+	)
+	return controller
+}
+
+func podEventSelector(ns, podName string) fields.Selector {
+	return fields.Set{
+		"involvedObject.kind":      "Pod",
+		"involvedObject.namespace": ns,
+		"involvedObject.name":      podName,
+	}.AsSelector()
+}
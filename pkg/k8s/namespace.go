@@ -1,7 +1,15 @@
 package k8s
 
 import (
+	"time"
+
 	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/controller/framework"
+	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/labels"
+	"k8s.io/kubernetes/pkg/runtime"
+	"k8s.io/kubernetes/pkg/watch"
 )
 
 // NamespaceLister is a (k8s.io/kubernetes/pkg/client/unversioned).NamespaceInterface compatible
@@ -16,3 +24,84 @@ import (
 type NamespaceLister interface {
 	List(opts api.ListOptions) (*api.NamespaceList, error)
 }
+
+// NamespaceListWatcher is a (k8s.io/kubernetes/pkg/client/unversioned).NamespaceInterface
+// compatible interface which has the List and Watch functions that an informer needs.
+type NamespaceListWatcher interface {
+	NamespaceLister
+	Watch(opts api.ListOptions) (watch.Interface, error)
+}
+
+// NamespaceWatcher keeps a cache of the namespaces in the cluster up to date with a watch, and
+// notifies whenever a namespace is deleted or stops matching its selector.
+type NamespaceWatcher struct {
+	Store      cache.Store
+	Controller *framework.Controller
+	changed    chan struct{}
+}
+
+// NewNamespaceWatcher creates a NamespaceWatcher that lists and watches the namespaces matching
+// selector with nlw, and resyncs its cache every resync.
+func NewNamespaceWatcher(nlw NamespaceListWatcher, selector labels.Selector, resync time.Duration) *NamespaceWatcher {
+	nw := &NamespaceWatcher{changed: make(chan struct{}, 1)}
+	nw.Store, nw.Controller = framework.NewInformer(
+		&cache.ListWatch{
+			ListFunc: func(opts api.ListOptions) (runtime.Object, error) {
+				return nlw.List(api.ListOptions{
+					LabelSelector: selector,
+					FieldSelector: fields.Everything(),
+				})
+			},
+			WatchFunc: func(opts api.ListOptions) (watch.Interface, error) {
+				return nlw.Watch(api.ListOptions{
+					LabelSelector:   selector,
+					FieldSelector:   fields.Everything(),
+					ResourceVersion: opts.ResourceVersion,
+				})
+			},
+		},
+		&api.Namespace{},
+		resync,
+		nw.handlers(selector),
+	)
+	return nw
+}
+
+// handlers returns the event handlers that notify when a namespace is deleted or, having been
+// updated, doesn't match selector anymore. A resync calls UpdateFunc for every namespace in the
+// cache, which isn't a change, so periodic work has to run on its own timer.
+func (nw *NamespaceWatcher) handlers(selector labels.Selector) framework.ResourceEventHandlerFuncs {
+	return framework.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if ns, ok := newObj.(*api.Namespace); ok && !selector.Matches(labels.Set(ns.Labels)) {
+				nw.notify()
+			}
+		},
+		DeleteFunc: func(obj interface{}) { nw.notify() },
+	}
+}
+
+// Namespaces returns the namespaces in the cache.
+func (nw *NamespaceWatcher) Namespaces() []api.Namespace {
+	objs := nw.Store.List()
+	namespaces := make([]api.Namespace, 0, len(objs))
+	for _, obj := range objs {
+		if ns, ok := obj.(*api.Namespace); ok {
+			namespaces = append(namespaces, *ns)
+		}
+	}
+	return namespaces
+}
+
+// Changed returns a channel that receives a value after a namespace was deleted or stopped
+// matching the selector. Notifications that happen while nobody is receiving are coalesced into one.
+func (nw *NamespaceWatcher) Changed() <-chan struct{} {
+	return nw.changed
+}
+
+func (nw *NamespaceWatcher) notify() {
+	select {
+	case nw.changed <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,39 @@
+package k8s
+
+import (
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+func TestNamespaceWatcherHandlers(t *testing.T) {
+	nw := &NamespaceWatcher{changed: make(chan struct{}, 1)}
+	h := nw.handlers(labels.SelectorFromSet(labels.Set{"heritage": "deis"}))
+	ns := func(lbls map[string]string) *api.Namespace {
+		return &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "myapp", Labels: lbls}}
+	}
+	notified := func() bool {
+		select {
+		case <-nw.Changed():
+			return true
+		default:
+			return false
+		}
+	}
+
+	// a resync updates every namespace with itself.
+	deis := ns(map[string]string{"heritage": "deis"})
+	h.OnUpdate(deis, deis)
+	if notified() {
+		t.Errorf("expected no notification for an update of a matching namespace")
+	}
+	h.OnUpdate(deis, ns(nil))
+	if !notified() {
+		t.Errorf("expected a notification for a namespace that stopped matching")
+	}
+	h.OnDelete(deis)
+	if !notified() {
+		t.Errorf("expected a notification for a deleted namespace")
+	}
+}
@@ -20,38 +20,59 @@ var (
 type PodWatcher struct {
 	Store      cache.StoreToPodLister
 	Controller *framework.Controller
+	changed    chan struct{}
 }
 
-//NewPodWatcher creates a new BuildPodWatcher useful to list the pods using a cache which gets updated based on the watch func.
-func NewPodWatcher(c *client.Client, ns string) *PodWatcher {
-	pw := &PodWatcher{}
+//NewPodWatcher creates a new BuildPodWatcher useful to list the pods matching selector using a cache which gets updated based on the watch func.
+//The selector keeps both the cache and the load on the API server down to the pods the caller is interested in.
+func NewPodWatcher(c *client.Client, ns string, selector labels.Selector) *PodWatcher {
+	pw := &PodWatcher{changed: make(chan struct{}, 1)}
+	notify := func(obj interface{}) { pw.notify() }
 
 	pw.Store.Store, pw.Controller = framework.NewIndexerInformer(
 		&cache.ListWatch{
-			ListFunc:  podListFunc(c, ns),
-			WatchFunc: podWatchFunc(c, ns),
+			ListFunc:  podListFunc(c, ns, selector),
+			WatchFunc: podWatchFunc(c, ns, selector),
 		},
 		&api.Pod{},
 		resyncPeriod,
-		framework.ResourceEventHandlerFuncs{},
+		framework.ResourceEventHandlerFuncs{
+			AddFunc:    notify,
+			UpdateFunc: func(oldObj, newObj interface{}) { pw.notify() },
+			DeleteFunc: notify,
+		},
 		cache.Indexers{},
 	)
 
 	return pw
 }
 
-func podListFunc(c *client.Client, ns string) func(options api.ListOptions) (runtime.Object, error) {
+//Changed returns a channel that receives a value after the cache has been updated. Notifications that happen while nobody
+//is receiving are coalesced into one, so a receiver should re-read the store rather than count notifications.
+func (pw *PodWatcher) Changed() <-chan struct{} {
+	return pw.changed
+}
+
+func (pw *PodWatcher) notify() {
+	select {
+	case pw.changed <- struct{}{}:
+	default:
+	}
+}
+
+func podListFunc(c *client.Client, ns string, selector labels.Selector) func(options api.ListOptions) (runtime.Object, error) {
 	return func(opts api.ListOptions) (runtime.Object, error) {
 		return c.Pods(ns).List(api.ListOptions{
-			LabelSelector: labels.Everything(),
+			LabelSelector: selector,
 		})
 	}
 }
 
-func podWatchFunc(c *client.Client, ns string) func(options api.ListOptions) (watch.Interface, error) {
+func podWatchFunc(c *client.Client, ns string, selector labels.Selector) func(options api.ListOptions) (watch.Interface, error) {
 	return func(opts api.ListOptions) (watch.Interface, error) {
 		return c.Pods(ns).Watch(api.ListOptions{
-			LabelSelector: labels.Everything(),
+			LabelSelector:   selector,
+			ResourceVersion: opts.ResourceVersion,
 		})
 	}
 }
@@ -4,6 +4,8 @@ import (
 	"time"
 )
 
+const defaultCleanerResyncPeriodSec = 300
+
 // Config represents the required SSH server configuration.
 type Config struct {
 	ControllerHost               string `envconfig:"DEIS_CONTROLLER_SERVICE_HOST" required:"true"`
@@ -12,16 +14,53 @@ type Config struct {
 	SSHHostPort                  int    `envconfig:"SSH_HOST_PORT" default:"2223" required:"true"`
 	HealthSrvPort                int    `envconfig:"HEALTH_SERVER_PORT" default:"8092"`
 	HealthSrvTestStorageRegion   string `envconfig:"STORAGE_REGION" default:"us-east-1"`
-	CleanerPollSleepDurationSec  int    `envconfig:"CLEANER_POLL_SLEEP_DURATION_SEC" default:"5"`
+	CleanerResyncPeriodSec       int    `envconfig:"CLEANER_RESYNC_PERIOD_SEC" default:"300"`
+	CleanerPollSleepDurationSec  int    `envconfig:"CLEANER_POLL_SLEEP_DURATION_SEC" default:"0"` // deprecated, see CleanerResyncPeriod
+	CleanerGracePeriodSec        int    `envconfig:"CLEANER_GRACE_PERIOD_SEC" default:"300"`
+	CleanerAppSource             string `envconfig:"CLEANER_APP_SOURCE" default:"namespaces"`
+	CleanerNamespaceSelector     string `envconfig:"CLEANER_NAMESPACE_SELECTOR" default:""`
+	CleanerDryRun                bool   `envconfig:"CLEANER_DRY_RUN" default:"false"`
+	CleanerMaxDeletePercent      int    `envconfig:"CLEANER_MAX_DELETE_PERCENT" default:"50"`
 	StorageType                  string `envconfig:"BUILDER_STORAGE" default:"minio"`
 	SlugBuilderImagePullPolicy   string `envconfig:"SLUG_BUILDER_IMAGE_PULL_POLICY" default:"Always"`
 	DockerBuilderImagePullPolicy string `envconfig:"DOCKER_BUILDER_IMAGE_PULL_POLICY" default:"Always"`
 	LockTimeout                  int    `envconfig:"GIT_LOCK_TIMEOUT" default:"10"`
+	SlugRetentionBuilds          int    `envconfig:"SLUG_RETENTION_BUILDS" default:"0"`
+	SlugRetentionMaxAgeDays      int    `envconfig:"SLUG_RETENTION_MAX_AGE_DAYS" default:"0"`
+	SlugRetentionIntervalSec     int    `envconfig:"SLUG_RETENTION_INTERVAL_SEC" default:"3600"`
+	BuildpackCacheMaxAgeDays     int    `envconfig:"BUILDPACK_CACHE_MAX_AGE_DAYS" default:"0"`
+	// CleanerControllerToken is the token of a controller user that can see every app, which the
+	// cleaner needs to find the current releases of apps.
+	CleanerControllerToken string `envconfig:"CLEANER_CONTROLLER_TOKEN" default:""`
+}
+
+// CleanerResyncPeriod returns c.CleanerResyncPeriodSec as a time.Duration. If it's left at its
+// default, the deprecated c.CleanerPollSleepDurationSec takes its place when it's set.
+func (c Config) CleanerResyncPeriod() time.Duration {
+	if c.CleanerResyncPeriodSec == defaultCleanerResyncPeriodSec && c.CleanerPollSleepDurationSec > 0 {
+		return time.Duration(c.CleanerPollSleepDurationSec) * time.Second
+	}
+	return time.Duration(c.CleanerResyncPeriodSec) * time.Second
+}
+
+// CleanerGracePeriod returns c.CleanerGracePeriodSec as a time.Duration.
+func (c Config) CleanerGracePeriod() time.Duration {
+	return time.Duration(c.CleanerGracePeriodSec) * time.Second
+}
+
+// SlugRetentionMaxAge returns c.SlugRetentionMaxAgeDays as a time.Duration.
+func (c Config) SlugRetentionMaxAge() time.Duration {
+	return time.Duration(c.SlugRetentionMaxAgeDays) * 24 * time.Hour
+}
+
+// BuildpackCacheMaxAge returns c.BuildpackCacheMaxAgeDays as a time.Duration.
+func (c Config) BuildpackCacheMaxAge() time.Duration {
+	return time.Duration(c.BuildpackCacheMaxAgeDays) * 24 * time.Hour
 }
 
-// CleanerPollSleepDuration returns c.CleanerPollSleepDurationSec as a time.Duration.
-func (c Config) CleanerPollSleepDuration() time.Duration {
-	return time.Duration(c.CleanerPollSleepDurationSec) * time.Second
+// SlugRetentionInterval returns c.SlugRetentionIntervalSec as a time.Duration.
+func (c Config) SlugRetentionInterval() time.Duration {
+	return time.Duration(c.SlugRetentionIntervalSec) * time.Second
 }
 
 //GitLockTimeout return LockTimeout in minutes
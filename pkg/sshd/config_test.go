@@ -0,0 +1,20 @@
+package sshd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arschles/assert"
+)
+
+func TestCleanerResyncPeriod(t *testing.T) {
+	c := Config{CleanerResyncPeriodSec: defaultCleanerResyncPeriodSec}
+	assert.Equal(t, c.CleanerResyncPeriod(), 5*time.Minute, "resync period")
+
+	// the deprecated setting is used while the resync period is left at its default.
+	c.CleanerPollSleepDurationSec = 30
+	assert.Equal(t, c.CleanerResyncPeriod(), 30*time.Second, "resync period from the deprecated setting")
+
+	c.CleanerResyncPeriodSec = 60
+	assert.Equal(t, c.CleanerResyncPeriod(), time.Minute, "resync period over the deprecated setting")
+}
@@ -173,12 +173,13 @@ func (s *server) handleConn(conn net.Conn, conf *ssh.ServerConfig) {
 		log.Info("Channel type: %s\n", incoming.ChannelType())
 		if incoming.ChannelType() != "session" {
 			incoming.Reject(ssh.UnknownChannelType, "Unknown channel type")
+			continue
 		}
 
 		channel, req, err := incoming.Accept()
 		if err != nil {
-			// Should close request and move on.
-			panic(err)
+			log.Err("Failed to accept channel: %s", err)
+			continue
 		}
 		go s.answer(channel, req, condata, sshConn)
 	}
@@ -197,27 +198,20 @@ func sshConnection(conn net.Conn) string {
 	return fmt.Sprintf("%s %s %s %s", rhost, rport, lhost, lport)
 }
 
-func sendExitStatus(status uint32, channel ssh.Channel) error {
-	exit := struct{ Status uint32 }{uint32(0)}
-	_, err := channel.SendRequest("exit-status", false, ssh.Marshal(exit))
-	return err
-}
-
 // answer handles answering requests and channel requests
 //
 // Currently, an exec must be either "ping", "git-receive-pack" or
-// "git-upload-pack". Anything else will result in a failure response. Right
-// now, we leave the channel open on failure because it is unclear what the
-// correct behavior for a failed exec is.
+// "git-upload-pack". Anything else will result in a failure response. Every
+// exec ends the session: the client is sent the exit status of the command
+// and the channel is closed.
 //
 // Support for setting environment variables via `env` has been disabled.
 func (s *server) answer(channel ssh.Channel, requests <-chan *ssh.Request, condata string, sshconn *ssh.ServerConn) error {
-	defer channel.Close()
+	sess := newSession(channel)
+	defer sess.close()
 
 	// Answer all the requests on this connection.
 	for req := range requests {
-		ok := false
-
 		switch req.Type {
 		case "env":
 			o := &EnvVar{}
@@ -225,56 +219,7 @@ func (s *server) answer(channel ssh.Channel, requests <-chan *ssh.Request, conda
 			log.Info("Key='%s', Value='%s'\n", o.Name, o.Value)
 			req.Reply(true, nil)
 		case "exec":
-			clean := cleanExec(req.Payload)
-			parts := strings.SplitN(clean, " ", 2)
-			switch parts[0] {
-			case "ping":
-				err := Ping(channel, req)
-				if err != nil {
-					log.Info("Error pinging: %s", err)
-				}
-				return err
-			case "git-receive-pack", "git-upload-pack":
-				if len(parts) < 2 {
-					log.Info("Expected two-part command.")
-					req.Reply(ok, nil)
-					break
-				}
-				repoName, err := cleanRepoName(parts[1])
-				if err != nil {
-					log.Err("Illegal repo name: %s.", err)
-					channel.Stderr().Write([]byte("No repo given"))
-					return err
-				}
-				wrapErr := wrapInLock(s.pushLock, repoName, s.runReceive(req, sshconn, channel, repoName, parts, condata))
-				if wrapErr == errAlreadyLocked {
-					log.Info(multiplePush)
-					// The error must be in git format
-					if pktErr := gitPktLine(channel, fmt.Sprintf("ERR %v\n", multiplePush)); pktErr != nil {
-						log.Err("Failed to write to channel: %s", err)
-					}
-					sendExitStatus(1, channel)
-					return nil
-				}
-
-				var xs uint32
-				if wrapErr != nil {
-					log.Err("Failed git receive: %v", wrapErr)
-					xs = 1
-				}
-				sendExitStatus(xs, channel)
-
-				return nil
-			default:
-				log.Info("Illegal command is '%s'\n", clean)
-				req.Reply(false, nil)
-				return nil
-			}
-
-			if err := sendExitStatus(0, channel); err != nil {
-				log.Err("Failed to write exit status: %s", err)
-			}
-			return nil
+			return s.exec(sess, req, condata, sshconn)
 		default:
 			// We simply ignore all of the other cases and leave the
 			// channel open to take additional requests.
@@ -286,8 +231,59 @@ func (s *server) answer(channel ssh.Channel, requests <-chan *ssh.Request, conda
 	return nil
 }
 
+// exec runs a single exec request and ends sess with the resulting exit status.
+func (s *server) exec(sess *session, req *ssh.Request, condata string, sshconn *ssh.ServerConn) error {
+	clean := cleanExec(req.Payload)
+	parts := strings.SplitN(clean, " ", 2)
+	switch parts[0] {
+	case "ping":
+		if err := Ping(sess.channel, req); err != nil {
+			log.Info("Error pinging: %s", err)
+			sess.exit(exitStatusFailed)
+			return err
+		}
+		sess.exit(exitStatusOK)
+		return nil
+	case "git-receive-pack", "git-upload-pack":
+		if len(parts) < 2 {
+			log.Info("Expected two-part command.")
+			req.Reply(false, nil)
+			sess.exit(exitStatusFailed)
+			return nil
+		}
+		req.Reply(true, nil)
+		repoName, err := cleanRepoName(parts[1])
+		if err != nil {
+			log.Err("Illegal repo name: %s.", err)
+			sess.gitFail(err.Error())
+			return err
+		}
+		wrapErr := wrapInLock(s.pushLock, repoName, s.runReceive(sshconn, sess.channel, repoName, parts, condata))
+		switch wrapErr {
+		case nil:
+			sess.exit(exitStatusOK)
+		case errAlreadyLocked:
+			log.Info(multiplePush)
+			sess.gitFail(multiplePush)
+		case errBuildAppPerm:
+			log.Info("User %s has no permission to build %s", sshconn.Permissions.Extensions["user"], repoName)
+			sess.gitFail(wrapErr.Error())
+		default:
+			// git is already talking to the client at this point, so the error can't be sent as
+			// a pkt-line without corrupting the stream.
+			log.Err("Failed git receive: %v", wrapErr)
+			sess.fail(wrapErr.Error())
+		}
+		return nil
+	default:
+		log.Info("Illegal command is '%s'\n", clean)
+		req.Reply(false, nil)
+		sess.exit(exitStatusFailed)
+		return nil
+	}
+}
+
 func (s *server) runReceive(
-	req *ssh.Request,
 	sshConn *ssh.ServerConn,
 	channel ssh.Channel,
 	repoName string,
@@ -295,7 +291,6 @@ func (s *server) runReceive(
 	connData string,
 ) func() error {
 	return func() error {
-		req.Reply(true, nil) // We processed. Yay.
 		if !strings.Contains(sshConn.Permissions.Extensions["apps"], repoName) {
 			return errBuildAppPerm
 		}
@@ -343,7 +338,8 @@ func cleanExec(pay []byte) string {
 
 // Ping handles a simple test SSH exec.
 //
-// Returns the string PONG and exit status 0.
+// Writes the string "pong" to the channel. Sending the exit status and closing the channel is
+// left to the caller.
 //
 // Params:
 // 	- channel (ssh.Channel): The channel to respond on.
@@ -351,11 +347,11 @@ func cleanExec(pay []byte) string {
 //
 func Ping(channel ssh.Channel, req *ssh.Request) error {
 	log.Info("PING")
+	req.Reply(true, nil)
 	if _, err := channel.Write([]byte("pong")); err != nil {
 		log.Err("Failed to write to channel: %s", err)
+		return err
 	}
-	sendExitStatus(0, channel)
-	req.Reply(true, nil)
 	return nil
 }
 
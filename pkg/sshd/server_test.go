@@ -2,8 +2,14 @@ package sshd
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -29,10 +35,20 @@ func TestGitPktLine(t *testing.T) {
 }
 
 func serverConfigure() (*ssh.ServerConfig, error) {
+	clientKey, err := sshTestingClientKey()
+	if err != nil {
+		return nil, err
+	}
 	cfg := &ssh.ServerConfig{
 		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
 			return mockAuthKey()
 		},
+		PublicKeyCallback: func(c ssh.ConnMetadata, k ssh.PublicKey) (*ssh.Permissions, error) {
+			if !bytes.Equal(k.Marshal(), clientKey.PublicKey().Marshal()) {
+				return nil, errors.New("unknown public key")
+			}
+			return mockAuthKey()
+		},
 	}
 	return cfg, nil
 }
@@ -232,6 +248,107 @@ func TestConcurrentPushDifferentRepo(t *testing.T) {
 	assert.NoErr(t, waitWithTimeout(&wg, 1*time.Second))
 }
 
+// fakeBootScript stands in for the builder binary called by the pre-receive hook. It exits with
+// the status found in $DEIS_TEST_BUILD_STATUS so tests can simulate failed builds.
+const fakeBootScript = `#!/bin/sh
+cat > /dev/null
+echo "fake build for $REPOSITORY"
+exit ${DEIS_TEST_BUILD_STATUS:-0}
+`
+
+// TestGitPush drives a real git client, over a real ssh client, against the server. It checks
+// that successful and failed builds are reported to the pushing client.
+func TestGitPush(t *testing.T) {
+	const testingServerAddr = "127.0.0.1:2253"
+	for _, bin := range []string{"git", "git-shell", "ssh"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%s is not installed, skipping", bin)
+		}
+	}
+
+	tmpDir, err := ioutil.TempDir("", "sshd-git-push")
+	assert.NoErr(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	gitHomeDir := filepath.Join(tmpDir, "git")
+	binDir := filepath.Join(tmpDir, "bin")
+	workDir := filepath.Join(tmpDir, "work")
+	for _, dir := range []string{gitHomeDir, binDir, workDir} {
+		assert.NoErr(t, os.MkdirAll(dir, 0755))
+	}
+	assert.NoErr(t, ioutil.WriteFile(filepath.Join(binDir, "boot"), []byte(fakeBootScript), 0755))
+	keyFile := filepath.Join(tmpDir, "id_rsa")
+	assert.NoErr(t, ioutil.WriteFile(keyFile, []byte(testingClientKey+"\n"), 0600))
+
+	// the pre-receive hook inherits the server's environment, so this is how it finds the fake
+	// builder binary.
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", oldPath)
+	assert.NoErr(t, os.Setenv("PATH", binDir+string(os.PathListSeparator)+oldPath))
+	defer os.Unsetenv("DEIS_TEST_BUILD_STATUS")
+
+	key, err := sshTestingHostKey()
+	assert.NoErr(t, err)
+	cfg, err := serverConfigure()
+	assert.NoErr(t, err)
+	cfg.AddHostKey(key)
+	c := NewCircuit()
+	pushLock := NewInMemoryRepositoryLock(time.Minute)
+	go func() {
+		if err := Serve(cfg, c, gitHomeDir, pushLock, testingServerAddr, "gitreceive"); err != nil {
+			t.Errorf("Failed serving with %s", err)
+		}
+	}()
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, c.State(), ClosedState, "circuit state")
+
+	git := func(args ...string) (string, error) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = workDir
+		cmd.Env = append(
+			os.Environ(),
+			"GIT_SSH_COMMAND=ssh -i "+keyFile+" -o IdentitiesOnly=yes -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null -o HostKeyAlgorithms=+ssh-rsa -o PubkeyAcceptedKeyTypes=+ssh-rsa",
+			"GIT_AUTHOR_NAME=deis",
+			"GIT_AUTHOR_EMAIL=deis@example.com",
+			"GIT_COMMITTER_NAME=deis",
+			"GIT_COMMITTER_EMAIL=deis@example.com",
+		)
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+	remote := func(repo string) string {
+		return fmt.Sprintf("ssh://git@%s/%s.git", testingServerAddr, repo)
+	}
+
+	_, err = git("init")
+	assert.NoErr(t, err)
+	_, err = git("commit", "--allow-empty", "-m", "first")
+	assert.NoErr(t, err)
+
+	// a successful build
+	out, err := git("push", remote("demo"), "HEAD:refs/heads/master")
+	assert.NoErr(t, err)
+	assert.True(t, strings.Contains(out, "fake build for demo.git"), "build output missing from push output:\n%s", out)
+	localSha, err := git("rev-parse", "HEAD")
+	assert.NoErr(t, err)
+	remoteSha, err := git("--git-dir", filepath.Join(gitHomeDir, "demo.git"), "rev-parse", "refs/heads/master")
+	assert.NoErr(t, err)
+	assert.Equal(t, remoteSha, localSha, "pushed sha")
+
+	// a failed build
+	assert.NoErr(t, os.Setenv("DEIS_TEST_BUILD_STATUS", "1"))
+	_, err = git("commit", "--allow-empty", "-m", "second")
+	assert.NoErr(t, err)
+	out, err = git("push", remote("demo"), "HEAD:refs/heads/master")
+	assert.True(t, err != nil, "push of a failed build succeeded:\n%s", out)
+	assert.True(t, strings.Contains(out, "pre-receive hook declined"), "rejection missing from push output:\n%s", out)
+
+	// an app the user can't build
+	out, err = git("push", remote("notmyapp"), "HEAD:refs/heads/master")
+	assert.True(t, err != nil, "push to an app without permission succeeded:\n%s", out)
+	assert.True(t, strings.Contains(out, "remote error: "+errBuildAppPerm.Error()), "permission error missing from push output:\n%s", out)
+}
+
 // sshTestingHostKey loads the testing key.
 func sshTestingHostKey() (ssh.Signer, error) {
 	return ssh.ParsePrivateKey([]byte(testingHostKey))
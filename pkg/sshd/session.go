@@ -0,0 +1,86 @@
+package sshd
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/deis/pkg/log"
+	"golang.org/x/crypto/ssh"
+)
+
+// Exit statuses sent to the client when a session ends.
+const (
+	exitStatusOK     uint32 = 0
+	exitStatusFailed uint32 = 1
+)
+
+// exitStatusMsg is the payload of an "exit-status" channel request.
+//
+// See https://tools.ietf.org/html/rfc4254#section-6.10
+type exitStatusMsg struct {
+	Status uint32
+}
+
+func sendExitStatus(status uint32, channel ssh.Channel) error {
+	_, err := channel.SendRequest("exit-status", false, ssh.Marshal(exitStatusMsg{Status: status}))
+	return err
+}
+
+// session is the termination layer for a single SSH session channel. Whichever way the session
+// ends, it guarantees that the client receives at most one exit status and that the channel is
+// closed exactly once.
+type session struct {
+	channel ssh.Channel
+	once    sync.Once
+}
+
+func newSession(channel ssh.Channel) *session {
+	return &session{channel: channel}
+}
+
+// exit sends status to the client, then closes the channel. Only the first call to exit, fail,
+// gitFail or close has any effect.
+func (s *session) exit(status uint32) {
+	s.once.Do(func() {
+		if err := sendExitStatus(status, s.channel); err != nil {
+			log.Err("Failed to write exit status %d: %s", status, err)
+		}
+		s.shutdown()
+	})
+}
+
+// close closes the channel without sending an exit status. It's meant for sessions that end
+// before the client issued a command, so there is no status to report.
+func (s *session) close() {
+	s.once.Do(s.shutdown)
+}
+
+// fail writes msg to the client's stderr and ends the session with a failed exit status.
+func (s *session) fail(msg string) {
+	if _, err := fmt.Fprintln(s.channel.Stderr(), msg); err != nil {
+		log.Err("Failed to write to channel: %s", err)
+	}
+	s.exit(exitStatusFailed)
+}
+
+// gitFail reports msg to a git client and ends the session with a failed exit status. The
+// message is written as an "ERR" pkt-line, which git shows as "fatal: remote error: <msg>", so
+// gitFail must only be called before git-receive-pack or git-upload-pack has started talking to
+// the client. The message is mirrored on stderr for clients that don't speak the git protocol.
+func (s *session) gitFail(msg string) {
+	if err := gitPktLine(s.channel, fmt.Sprintf("ERR %s\n", msg)); err != nil {
+		log.Err("Failed to write to channel: %s", err)
+	}
+	s.fail(msg)
+}
+
+func (s *session) shutdown() {
+	// CloseWrite sends EOF so the client stops reading before the channel goes away.
+	if err := s.channel.CloseWrite(); err != nil && err != io.EOF {
+		log.Debug("Failed to send EOF on channel: %s", err)
+	}
+	if err := s.channel.Close(); err != nil && err != io.EOF {
+		log.Debug("Failed to close channel: %s", err)
+	}
+}
@@ -0,0 +1,82 @@
+package sshd
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/arschles/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+type exitStatusCase struct {
+	cmd     string
+	status  int
+	out     string
+	lockFor string
+}
+
+// TestExitStatus checks that every way a session can end reports the right exit status.
+func TestExitStatus(t *testing.T) {
+	const testingServerAddr = "127.0.0.1:2254"
+	key, err := sshTestingHostKey()
+	assert.NoErr(t, err)
+	cfg, err := serverConfigure()
+	assert.NoErr(t, err)
+	cfg.AddHostKey(key)
+
+	c := NewCircuit()
+	pushLock := NewInMemoryRepositoryLock(time.Minute)
+	runServer(cfg, c, pushLock, testingServerAddr, time.Duration(0), t)
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, c.State(), ClosedState, "circuit state")
+
+	client, err := ssh.Dial("tcp", testingServerAddr, clientConfig())
+	assert.NoErr(t, err)
+	defer client.Close()
+
+	permErr, err := gitPktLineStr(fmt.Sprintf("ERR %s\n", errBuildAppPerm))
+	assert.NoErr(t, err)
+	lockedErr, err := gitPktLineStr(fmt.Sprintf("ERR %s\n", multiplePush))
+	assert.NoErr(t, err)
+
+	cases := []exitStatusCase{
+		{cmd: "ping", status: 0, out: "pong"},
+		{cmd: "git-upload-pack /demo.git", status: 0, out: "OK"},
+		{cmd: "git-receive-pack /notmyapp.git", status: 1, out: permErr},
+		{cmd: "git-receive-pack /repo1.git", status: 1, out: lockedErr, lockFor: "repo1"},
+	}
+	for _, caze := range cases {
+		if caze.lockFor != "" {
+			assert.NoErr(t, pushLock.Lock(caze.lockFor))
+		}
+		sess, err := client.NewSession()
+		assert.NoErr(t, err)
+		out, err := sess.Output(caze.cmd)
+		sess.Close()
+		if caze.lockFor != "" {
+			assert.NoErr(t, pushLock.Unlock(caze.lockFor))
+		}
+
+		status := 0
+		if err != nil {
+			exitErr, ok := err.(*ssh.ExitError)
+			if !ok {
+				t.Fatalf("'%s': expected an exit status, got error %s", caze.cmd, err)
+			}
+			status = exitErr.ExitStatus()
+		}
+		assert.Equal(t, status, caze.status, fmt.Sprintf("'%s' exit status", caze.cmd))
+		assert.Equal(t, string(out), caze.out, fmt.Sprintf("'%s' output", caze.cmd))
+	}
+
+	// commands that are refused outright fail without output.
+	for _, cmd := range []string{"illegal", "git-receive-pack"} {
+		sess, err := client.NewSession()
+		assert.NoErr(t, err)
+		out, err := sess.Output(cmd)
+		sess.Close()
+		assert.True(t, err != nil, "'%s' succeeded, but should have failed", cmd)
+		assert.Equal(t, string(out), "", fmt.Sprintf("'%s' output", cmd))
+	}
+}
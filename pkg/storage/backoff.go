@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff is a policy for retrying failed storage operations, waiting exponentially longer
+// between attempts.
+type Backoff struct {
+	// Initial is the wait before the first retry. Every following wait doubles, up to Max.
+	Initial time.Duration
+	Max     time.Duration
+	// Deadline bounds the time spent on an operation and its retries, measured from the first
+	// attempt. No retry starts if its wait would end after the deadline.
+	Deadline time.Duration
+	// Jitter is the fraction, between 0 and 1, of every wait that's picked at random, so that
+	// builders retrying against the same store don't all do it in lockstep.
+	Jitter float64
+}
+
+// DefaultBackoff returns the policy used when a command doesn't configure its own.
+func DefaultBackoff() Backoff {
+	return Backoff{
+		Initial:  500 * time.Millisecond,
+		Max:      30 * time.Second,
+		Deadline: 5 * time.Minute,
+		Jitter:   0.5,
+	}
+}
+
+// wait returns the time to wait before the given retry, counting from 0.
+func (b Backoff) wait(retry int) time.Duration {
+	d := b.Initial
+	for i := 0; i < retry && d < b.Max; i++ {
+		d *= 2
+	}
+	if d > b.Max {
+		d = b.Max
+	}
+	if b.Jitter > 0 {
+		d -= time.Duration(b.Jitter * rand.Float64() * float64(d))
+	}
+	return d
+}
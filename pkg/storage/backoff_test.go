@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffWait(t *testing.T) {
+	b := Backoff{Initial: 100 * time.Millisecond, Max: time.Second}
+	expected := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for retry, exp := range expected {
+		if wait := b.wait(retry); wait != exp {
+			t.Errorf("retry %d: expected a wait of %s, got %s", retry, exp, wait)
+		}
+	}
+
+	b.Jitter = 0.5
+	for retry := 0; retry < 100; retry++ {
+		max := expected[len(expected)-1]
+		if retry < len(expected) {
+			max = expected[retry]
+		}
+		if wait := b.wait(retry); wait < max/2 || wait > max {
+			t.Errorf("retry %d: expected a wait between %s and %s, got %s", retry, max/2, max, wait)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/deis/builder/pkg/conf"
+	"github.com/deis/builder/pkg/sys"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	_ "github.com/docker/distribution/registry/storage/driver/azure"
+	"github.com/docker/distribution/registry/storage/driver/factory"
+	_ "github.com/docker/distribution/registry/storage/driver/filesystem"
+	_ "github.com/docker/distribution/registry/storage/driver/gcs"
+	_ "github.com/docker/distribution/registry/storage/driver/inmemory"
+	_ "github.com/docker/distribution/registry/storage/driver/s3-aws"
+	_ "github.com/docker/distribution/registry/storage/driver/swift"
+)
+
+// The storage backends that can be set in BUILDER_STORAGE.
+const (
+	BackendMinio      = "minio"
+	BackendS3         = "s3"
+	BackendGCS        = "gcs"
+	BackendAzure      = "azure"
+	BackendSwift      = "swift"
+	BackendFilesystem = "filesystem"
+	BackendInMemory   = "inmemory"
+)
+
+// requiredParams lists, for every backend, the driver parameters that have to be set for the
+// driver to work.
+var requiredParams = map[string][]string{
+	BackendMinio:      {"accesskey", "secretkey", "bucket", "regionendpoint"},
+	BackendS3:         {"bucket", "region"},
+	BackendGCS:        {"bucket", "keyfile"},
+	BackendAzure:      {"accountname", "accountkey", "container"},
+	BackendSwift:      {"authurl", "username", "password", "container"},
+	BackendFilesystem: {"rootdirectory"},
+	BackendInMemory:   {},
+}
+
+// Config is the storage configuration shared by every command that talks to object storage.
+type Config struct {
+	Type string `envconfig:"BUILDER_STORAGE" default:"minio"`
+	// Region is used by the s3 and swift backends when the storage credentials don't name one.
+	Region string `envconfig:"STORAGE_REGION" default:"us-east-1"`
+	// Endpoint overrides the s3 region endpoint or the swift auth URL. An s3 endpoint is always
+	// addressed path-style (http://endpoint/bucket/key), as S3 compatible stores expect.
+	Endpoint string `envconfig:"STORAGE_ENDPOINT" default:""`
+	// Insecure turns off TLS for s3 endpoints and certificate verification for swift.
+	Insecure    bool `envconfig:"STORAGE_INSECURE" default:"false"`
+	TimeoutMSec int  `envconfig:"STORAGE_TIMEOUT" default:"300000"` // 5 minutes
+	// Backoff controls the retries of failed operations. It isn't read from the environment; each
+	// command sets it from its own settings.
+	Backoff Backoff
+}
+
+// Timeout returns the maximum time a single storage operation may take.
+func (c Config) Timeout() time.Duration {
+	return time.Duration(c.TimeoutMSec) * time.Millisecond
+}
+
+// NewDriver creates the storage driver for the backend in cnf, from the storage credentials and
+// env. It returns an error naming what's missing if the parameters aren't enough for the backend.
+//
+// The returned driver bounds every operation with cnf.Timeout(), retries failed operations
+// according to cnf.Backoff and logs how long each operation took.
+func NewDriver(cnf *Config, env sys.Env) (storagedriver.StorageDriver, error) {
+	params, err := conf.GetStorageParams(env)
+	if err != nil {
+		return nil, fmt.Errorf("getting storage parameters (%s)", err)
+	}
+	if err := applyOptions(cnf, params); err != nil {
+		return nil, err
+	}
+	if err := validateParams(cnf.Type, params); err != nil {
+		return nil, err
+	}
+
+	name := cnf.Type
+	if name == BackendMinio {
+		name = BackendS3
+	}
+	driver, err := factory.Create(name, params)
+	if err != nil {
+		return nil, fmt.Errorf("creating %s storage driver (%s)", cnf.Type, err)
+	}
+	return newManagedDriver(driver, cnf.Timeout(), cnf.Backoff), nil
+}
+
+// applyOptions adds the per-backend settings in cnf to params. Settings from the storage
+// credentials take precedence over the region, which always has a default.
+func applyOptions(cnf *Config, params conf.Parameters) error {
+	switch cnf.Type {
+	case BackendMinio, BackendS3:
+		if cnf.Endpoint != "" {
+			params["regionendpoint"] = cnf.Endpoint
+		}
+		if cnf.Insecure {
+			params["secure"] = false
+		}
+		setDefault(params, "region", cnf.Region)
+	case BackendSwift:
+		if cnf.Endpoint != "" {
+			params["authurl"] = cnf.Endpoint
+		}
+		if cnf.Insecure {
+			params["insecureskipverify"] = true
+		}
+		setDefault(params, "region", cnf.Region)
+	case BackendGCS, BackendAzure, BackendFilesystem, BackendInMemory:
+		if cnf.Endpoint != "" {
+			return fmt.Errorf("the %s storage backend doesn't support a custom endpoint", cnf.Type)
+		}
+	}
+	return nil
+}
+
+// validateParams checks that params has everything the backend needs.
+func validateParams(backend string, params conf.Parameters) error {
+	required, ok := requiredParams[backend]
+	if !ok {
+		return fmt.Errorf("unknown storage backend %q", backend)
+	}
+	var missing []string
+	for _, name := range required {
+		if isEmpty(params[name]) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("the %s storage backend requires the %s parameters, which are missing from the storage credentials", backend, strings.Join(missing, ", "))
+	}
+	if backend == BackendMinio {
+		return validateMinioEndpoint(fmt.Sprintf("%v", params["regionendpoint"]))
+	}
+	return nil
+}
+
+// validateMinioEndpoint checks that endpoint has a host, and a port if it has a colon; without
+// one, it uses the default port of its scheme. The endpoint is made of the DEIS_MINIO_SERVICE_HOST
+// and DEIS_MINIO_SERVICE_PORT env vars unless STORAGE_ENDPOINT overrides it, so without those env
+// vars it's http://: instead of missing.
+func validateMinioEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("the %s storage backend endpoint %s is malformed (%s)", BackendMinio, endpoint, err)
+	}
+	host, port := u.Host, "default"
+	if strings.Contains(u.Host, ":") {
+		host, port, err = net.SplitHostPort(u.Host)
+	}
+	if err != nil || host == "" || port == "" {
+		return fmt.Errorf("the %s storage backend endpoint %s has no host or port, check that DEIS_MINIO_SERVICE_HOST and DEIS_MINIO_SERVICE_PORT are set", BackendMinio, endpoint)
+	}
+	return nil
+}
+
+func setDefault(params conf.Parameters, key string, val interface{}) {
+	if isEmpty(params[key]) {
+		params[key] = val
+	}
+}
+
+func isEmpty(val interface{}) bool {
+	return val == nil || fmt.Sprint(val) == ""
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/arschles/assert"
+	"github.com/deis/builder/pkg/conf"
+	"github.com/deis/builder/pkg/sys"
+	"github.com/docker/distribution/context"
+)
+
+func TestNewDriverInMemory(t *testing.T) {
+	env := sys.NewFakeEnv()
+	env.Envs["BUILDER_STORAGE"] = BackendInMemory
+	driver, err := NewDriver(&Config{Type: BackendInMemory}, env)
+	assert.NoErr(t, err)
+	assert.Equal(t, driver.Name(), "inmemory", "driver name")
+
+	ctx := context.Background()
+	assert.NoErr(t, driver.PutContent(ctx, "/home/app/tar", []byte("content")))
+	content, err := driver.GetContent(ctx, "/home/app/tar")
+	assert.NoErr(t, err)
+	assert.Equal(t, string(content), "content", "content")
+}
+
+func TestNewDriverFilesystem(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "tmpdir")
+	assert.NoErr(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	env := sys.NewFakeEnv()
+	env.Envs["BUILDER_STORAGE"] = BackendFilesystem
+	env.Envs["BUILDER_STORAGE_ROOT_DIRECTORY"] = tmpDir
+	driver, err := NewDriver(&Config{Type: BackendFilesystem}, env)
+	assert.NoErr(t, err)
+
+	assert.NoErr(t, driver.PutContent(context.Background(), "/home/app/tar", []byte("content")))
+	content, err := ioutil.ReadFile(filepath.Join(tmpDir, "home", "app", "tar"))
+	assert.NoErr(t, err)
+	assert.Equal(t, string(content), "content", "content")
+}
+
+func TestNewDriverErrors(t *testing.T) {
+	env := sys.NewFakeEnv()
+	env.Envs["BUILDER_STORAGE"] = BackendInMemory
+	_, err := NewDriver(&Config{Type: "floppy"}, env)
+	if err == nil || !strings.Contains(err.Error(), `unknown storage backend "floppy"`) {
+		t.Errorf("expected an unknown backend error, got %v", err)
+	}
+
+	_, err = NewDriver(&Config{Type: BackendInMemory, Endpoint: "http://localhost:9000"}, env)
+	if err == nil || !strings.Contains(err.Error(), "doesn't support a custom endpoint") {
+		t.Errorf("expected an endpoint error, got %v", err)
+	}
+}
+
+func TestApplyOptions(t *testing.T) {
+	params := conf.Parameters{"bucket": "builder"}
+	assert.NoErr(t, applyOptions(&Config{Type: BackendS3, Region: "eu-west-1", Endpoint: "http://ceph:7480", Insecure: true}, params))
+	assert.Equal(t, params, conf.Parameters{
+		"bucket":         "builder",
+		"region":         "eu-west-1",
+		"regionendpoint": "http://ceph:7480",
+		"secure":         false,
+	}, "s3 params")
+
+	// a region from the storage credentials wins over the configured one.
+	params = conf.Parameters{"region": "us-west-2"}
+	assert.NoErr(t, applyOptions(&Config{Type: BackendS3, Region: "us-east-1"}, params))
+	assert.Equal(t, params["region"], "us-west-2", "region")
+
+	params = conf.Parameters{}
+	assert.NoErr(t, applyOptions(&Config{Type: BackendSwift, Region: "RegionOne", Endpoint: "https://keystone/v3", Insecure: true}, params))
+	assert.Equal(t, params, conf.Parameters{
+		"authurl":            "https://keystone/v3",
+		"insecureskipverify": true,
+		"region":             "RegionOne",
+	}, "swift params")
+}
+
+func TestValidateParams(t *testing.T) {
+	assert.NoErr(t, validateParams(BackendGCS, conf.Parameters{"bucket": "builder", "keyfile": "/var/run/key.json"}))
+	assert.NoErr(t, validateParams(BackendInMemory, conf.Parameters{}))
+
+	err := validateParams(BackendAzure, conf.Parameters{"accountname": "deis", "container": nil})
+	if err == nil || !strings.Contains(err.Error(), "requires the accountkey, container parameters") {
+		t.Errorf("expected an error listing the missing parameters, got %v", err)
+	}
+
+	minio := conf.Parameters{"accesskey": "key", "secretkey": "secret", "regionendpoint": "http://minio:9000"}
+	err = validateParams(BackendMinio, minio)
+	if err == nil || !strings.Contains(err.Error(), "requires the bucket parameters") {
+		t.Errorf("expected an error about the missing minio bucket, got %v", err)
+	}
+	minio["bucket"] = "git"
+	assert.NoErr(t, validateParams(BackendMinio, minio))
+
+	// the endpoint that the storage params get without the minio service env vars.
+	minio["regionendpoint"] = "http://:"
+	err = validateParams(BackendMinio, minio)
+	if err == nil || !strings.Contains(err.Error(), "DEIS_MINIO_SERVICE_HOST") {
+		t.Errorf("expected an error about the minio service env vars, got %v", err)
+	}
+	minio["regionendpoint"] = "http://minio:"
+	if err := validateParams(BackendMinio, minio); err == nil {
+		t.Errorf("expected an error for a minio endpoint with an empty port")
+	}
+	minio["regionendpoint"] = "https://minio.example.com"
+	assert.NoErr(t, validateParams(BackendMinio, minio))
+}
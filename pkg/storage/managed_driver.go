@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/deis/pkg/log"
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	netcontext "golang.org/x/net/context"
+)
+
+// managedDriver wraps a storage driver so that the content, stat, list, move and delete
+// operations time out instead of hanging, failed operations are retried with backoff when it's
+// safe to run them again, and every operation is logged with how long it took. Reader, Writer and
+// URLFor go straight to the wrapped driver.
+type managedDriver struct {
+	storagedriver.StorageDriver
+	timeout time.Duration
+	backoff Backoff
+}
+
+func newManagedDriver(driver storagedriver.StorageDriver, timeout time.Duration, backoff Backoff) *managedDriver {
+	return &managedDriver{StorageDriver: driver, timeout: timeout, backoff: backoff}
+}
+
+// GetContent is the storagedriver.StorageDriver interface implementation.
+func (d *managedDriver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	content, err := d.do(ctx, "GetContent", path, true, func(ctx context.Context) (interface{}, error) {
+		return d.StorageDriver.GetContent(ctx, path)
+	})
+	b, _ := content.([]byte)
+	return b, err
+}
+
+// PutContent is the storagedriver.StorageDriver interface implementation.
+func (d *managedDriver) PutContent(ctx context.Context, path string, content []byte) error {
+	// writing the same content again leaves the object as a single successful write would.
+	_, err := d.do(ctx, "PutContent", path, true, func(ctx context.Context) (interface{}, error) {
+		return nil, d.StorageDriver.PutContent(ctx, path, content)
+	})
+	return err
+}
+
+// Stat is the storagedriver.StorageDriver interface implementation.
+func (d *managedDriver) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	info, err := d.do(ctx, "Stat", path, true, func(ctx context.Context) (interface{}, error) {
+		return d.StorageDriver.Stat(ctx, path)
+	})
+	fi, _ := info.(storagedriver.FileInfo)
+	return fi, err
+}
+
+// List is the storagedriver.StorageDriver interface implementation.
+func (d *managedDriver) List(ctx context.Context, path string) ([]string, error) {
+	keys, err := d.do(ctx, "List", path, true, func(ctx context.Context) (interface{}, error) {
+		return d.StorageDriver.List(ctx, path)
+	})
+	k, _ := keys.([]string)
+	return k, err
+}
+
+// Move is the storagedriver.StorageDriver interface implementation. A move that seemed to fail
+// may have happened anyway, after which the source is gone, so moves are never retried.
+func (d *managedDriver) Move(ctx context.Context, sourcePath string, destPath string) error {
+	_, err := d.do(ctx, "Move", sourcePath, false, func(ctx context.Context) (interface{}, error) {
+		return nil, d.StorageDriver.Move(ctx, sourcePath, destPath)
+	})
+	return err
+}
+
+// Delete is the storagedriver.StorageDriver interface implementation.
+func (d *managedDriver) Delete(ctx context.Context, path string) error {
+	var attempts int32
+	_, err := d.do(ctx, "Delete", path, true, func(ctx context.Context) (interface{}, error) {
+		attempt := atomic.AddInt32(&attempts, 1)
+		err := d.StorageDriver.Delete(ctx, path)
+		if _, ok := err.(storagedriver.PathNotFoundError); ok && attempt > 1 {
+			// an earlier attempt that seemed to fail deleted it after all.
+			return nil, nil
+		}
+		return nil, err
+	})
+	return err
+}
+
+// operation is a single attempt at a storage operation, returning its result, if any.
+type operation func(ctx context.Context) (interface{}, error)
+
+// do runs the operation op on path with fn. If op is idempotent, it's retried according to
+// d.backoff for as long as it fails with an error that may go away.
+func (d *managedDriver) do(ctx context.Context, op, path string, idempotent bool, fn operation) (interface{}, error) {
+	start := time.Now()
+	var res interface{}
+	var err error
+	for retry := 0; ; retry++ {
+		res, err = d.withTimeout(ctx, op, fn)
+		if err == nil || !idempotent || !isRetryable(err) {
+			break
+		}
+		wait := d.backoff.wait(retry)
+		if time.Since(start)+wait > d.backoff.Deadline {
+			break
+		}
+		log.Debug("storage: %s %s failed on attempt %d, retrying in %s (%s)", op, path, retry+1, wait, err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return res, err
+		}
+	}
+	if err != nil {
+		log.Debug("storage: %s %s failed after %s (%s)", op, path, time.Since(start), err)
+	} else {
+		log.Debug("storage: %s %s took %s", op, path, time.Since(start))
+	}
+	return res, err
+}
+
+type result struct {
+	val interface{}
+	err error
+}
+
+// withTimeout runs fn, giving up on it after d.timeout. Drivers that ignore the context keep
+// running fn in the background, but the caller no longer waits for it.
+func (d *managedDriver) withTimeout(ctx context.Context, op string, fn operation) (interface{}, error) {
+	if d.timeout <= 0 {
+		return fn(ctx)
+	}
+	tctx, cancel := netcontext.WithTimeout(ctx, d.timeout)
+	defer cancel()
+	resCh := make(chan result, 1)
+	go func() {
+		val, err := fn(tctx)
+		resCh <- result{val: val, err: err}
+	}()
+	select {
+	case res := <-resCh:
+		return res.val, res.err
+	case <-tctx.Done():
+		return nil, fmt.Errorf("%s timed out after %s (%s)", op, d.timeout, tctx.Err())
+	}
+}
+
+// isRetryable returns false for errors that trying again won't fix.
+func isRetryable(err error) bool {
+	switch err.(type) {
+	case storagedriver.PathNotFoundError, storagedriver.InvalidPathError, storagedriver.InvalidOffsetError:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arschles/assert"
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+// flakyDriver is an in-memory driver whose content operations fail a set number of times before
+// going through.
+type flakyDriver struct {
+	storagedriver.StorageDriver
+	failures int
+	calls    int
+	delay    time.Duration
+}
+
+func (f *flakyDriver) fail() error {
+	f.calls++
+	time.Sleep(f.delay)
+	if f.calls <= f.failures {
+		return errors.New("503 Service Unavailable")
+	}
+	return nil
+}
+
+func (f *flakyDriver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	if err := f.fail(); err != nil {
+		return nil, err
+	}
+	return f.StorageDriver.GetContent(ctx, path)
+}
+
+func (f *flakyDriver) PutContent(ctx context.Context, path string, content []byte) error {
+	if err := f.fail(); err != nil {
+		return err
+	}
+	return f.StorageDriver.PutContent(ctx, path, content)
+}
+
+// testBackoff retries quickly, for up to a second.
+func testBackoff() Backoff {
+	return Backoff{Initial: time.Millisecond, Max: 10 * time.Millisecond, Deadline: time.Second}
+}
+
+func (f *flakyDriver) Delete(ctx context.Context, path string) error {
+	err := f.StorageDriver.Delete(ctx, path)
+	if ferr := f.fail(); ferr != nil {
+		// the object is gone, but the response is lost.
+		return ferr
+	}
+	return err
+}
+
+func TestManagedDriverRetries(t *testing.T) {
+	flaky := &flakyDriver{StorageDriver: inmemory.New(), failures: 2}
+	d := newManagedDriver(flaky, time.Minute, testBackoff())
+	ctx := context.Background()
+	assert.NoErr(t, d.PutContent(ctx, "/obj", []byte("content")))
+	assert.Equal(t, flaky.calls, 3, "number of PutContent calls")
+
+	flaky.calls, flaky.failures = 0, 2
+	content, err := d.GetContent(ctx, "/obj")
+	assert.NoErr(t, err)
+	assert.Equal(t, string(content), "content", "content")
+	assert.Equal(t, flaky.calls, 3, "number of GetContent calls")
+
+	flaky.calls, flaky.failures = 0, 1
+	assert.NoErr(t, d.Delete(ctx, "/obj"))
+	assert.Equal(t, flaky.calls, 2, "number of Delete calls")
+	_, err = d.Stat(ctx, "/obj")
+	if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+		t.Errorf("expected the object to be deleted, got %v", err)
+	}
+}
+
+func TestManagedDriverGivesUpAtDeadline(t *testing.T) {
+	flaky := &flakyDriver{StorageDriver: inmemory.New(), failures: 1000}
+	backoff := testBackoff()
+	backoff.Deadline = 50 * time.Millisecond
+	d := newManagedDriver(flaky, time.Minute, backoff)
+	start := time.Now()
+	_, err := d.GetContent(context.Background(), "/obj")
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("expected the last error, got %v", err)
+	}
+	assert.True(t, flaky.calls > 1, "expected GetContent to be retried, got %d calls", flaky.calls)
+	if time.Since(start) > time.Second {
+		t.Errorf("GetContent took %s to give up", time.Since(start))
+	}
+}
+
+func TestManagedDriverDoesNotRetryMoves(t *testing.T) {
+	flaky := &flakyDriver{StorageDriver: inmemory.New(), failures: 1}
+	d := newManagedDriver(flaky, time.Minute, testBackoff())
+	assert.NoErr(t, d.PutContent(context.Background(), "/obj", []byte("content")))
+
+	moves := 0
+	d.StorageDriver = &movingDriver{StorageDriver: flaky.StorageDriver, moves: &moves}
+	err := d.Move(context.Background(), "/obj", "/moved")
+	assert.True(t, err != nil, "expected Move to fail")
+	assert.Equal(t, moves, 1, "number of Move calls")
+}
+
+// movingDriver fails every move after making it.
+type movingDriver struct {
+	storagedriver.StorageDriver
+	moves *int
+}
+
+func (m *movingDriver) Move(ctx context.Context, sourcePath string, destPath string) error {
+	*m.moves++
+	if err := m.StorageDriver.Move(ctx, sourcePath, destPath); err != nil {
+		return err
+	}
+	return errors.New("connection reset by peer")
+}
+
+func TestManagedDriverDoesNotRetryMissingPaths(t *testing.T) {
+	flaky := &flakyDriver{StorageDriver: inmemory.New()}
+	d := newManagedDriver(flaky, time.Minute, testBackoff())
+	_, err := d.GetContent(context.Background(), "/missing")
+	if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+		t.Errorf("expected a PathNotFoundError, got %v", err)
+	}
+	assert.Equal(t, flaky.calls, 1, "number of GetContent calls")
+}
+
+func TestManagedDriverTimeout(t *testing.T) {
+	flaky := &flakyDriver{StorageDriver: inmemory.New(), delay: time.Second}
+	d := newManagedDriver(flaky, 10*time.Millisecond, Backoff{})
+	start := time.Now()
+	err := d.PutContent(context.Background(), "/obj", []byte("content"))
+	if err == nil || !strings.Contains(err.Error(), "PutContent timed out after 10ms") {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("PutContent took %s to time out", time.Since(start))
+	}
+}